@@ -2,11 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"judge-service/internal/callback"
 	"judge-service/internal/config"
@@ -39,12 +40,6 @@ func main() {
 	// Initialize the new callback client
 	callbackClient := callback.NewClient(cfg.InternalApiUrl, cfg.InternalApiSecret)
 
-	consumer, err := queue.NewConsumer(cfg.RedisURL, cfg.RedisQueueName)
-	if err != nil {
-		log.Fatalf("Could not initialize queue consumer: %v", err)
-	}
-	log.Println("Successfully connected to Redis.")
-
 	storeInstance, err := store.NewMongoStore(ctx, cfg.MongoURI, cfg.MongoDBName)
 	if err != nil {
 		log.Fatalf("Could not connect to MongoDB: %v", err)
@@ -60,33 +55,74 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load language configurations: %v", err)
 	}
-	runnerInstance := runner.NewRunner(ctx, langConfig)
+	runnerInstance, err := runner.NewRunner(ctx, langConfig, cfg.Sandbox)
+	if err != nil {
+		log.Fatalf("Could not initialize runner: %v", err)
+	}
 
-	jobHandler := func(ctx context.Context, payload *store.SubmissionPayload) error {
+	pools, err := workerPools(runnerInstance.CPUs(), cfg.Workers, cfg.ReservedCPUs, cfg.Sandbox.ParallelTests)
+	if err != nil {
+		log.Fatalf("Could not assign CPUs to workers: %v", err)
+	}
+
+	consumer, err := queue.NewConsumer(cfg.RedisURL, len(pools), cfg.Queue)
+	if err != nil {
+		log.Fatalf("Could not initialize queue consumer: %v", err)
+	}
+	log.Println("Successfully connected to Redis.")
+
+	jobHandler := func(ctx context.Context, worker int, payload *store.SubmissionPayload) (any, error) {
 		// Pass the callback client to the job processor
-		return processJob(ctx, payload, storeInstance, runnerInstance, callbackClient)
+		result, err := processJob(ctx, payload, storeInstance, runnerInstance, callbackClient, pools[worker])
+		if result == nil {
+			return nil, err
+		}
+		return result, err
 	}
 
-	go consumer.Start(ctx, jobHandler)
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumer.Start(ctx, jobHandler)
+	}()
 
 	<-stopChan
 	log.Println("Shutdown signal received, gracefully stopping...")
 	cancel()
 
-	time.Sleep(2 * time.Second)
+	// Jobs cut short are left in the queue for the next start.
+	<-consumerDone
 	log.Println("Judge daemon stopped.")
 }
 
-func processJob(ctx context.Context, payload *store.SubmissionPayload, s *store.MongoStore, r *runner.Runner, cb *callback.Client) error {
+func processJob(ctx context.Context, payload *store.SubmissionPayload, s *store.MongoStore, r *runner.Runner, cb *callback.Client, pool testPool) (*store.SubmissionResult, error) {
 	log.Printf("Processing submission ID: %s", payload.SubmissionID)
+	r = r.Bind(ctx, pool.cpus)
 
-	var tempDir string
+	var tempDir, checkerDir, interactorDir string
 	defer func() {
-		if tempDir != "" {
-			r.CleanUp(tempDir)
+		for _, dir := range []string{tempDir, checkerDir, interactorDir} {
+			if dir != "" {
+				r.CleanUp(dir)
+			}
 		}
 	}()
 
+	// finish saves the outcome and reports it to the API server. A result
+	// of a job cut short by shutdown is not one: runs killed on the way
+	// look like Internal Errors, so nothing is saved and the job is judged
+	// again after the restart.
+	finish := func(result store.SubmissionResult) (*store.SubmissionResult, error) {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Judging of submission %s interrupted: %v", payload.SubmissionID, err)
+			return nil, err
+		}
+		if err := s.UpdateSubmissionResult(ctx, payload.SubmissionID, result); err != nil {
+			log.Printf("Failed to save result of submission %s: %v", payload.SubmissionID, err)
+		}
+		return &result, cb.SendResult(payload.SubmissionID, result)
+	}
+
 	// The judge service still updates the status to "Judging"
 	err := s.UpdateSubmissionStatus(ctx, payload.SubmissionID, store.StatusJudging)
 	if err != nil {
@@ -97,81 +133,180 @@ func processJob(ctx context.Context, payload *store.SubmissionPayload, s *store.
 	if err != nil {
 		log.Printf("Error fetching submission %s: %v", payload.SubmissionID, err)
 		// No need to update status here, let the API server handle it if it times out
-		return err
+		return nil, err
 	}
 
 	problem, err := s.GetProblem(ctx, submission.ProblemID)
 	if err != nil {
 		log.Printf("Error fetching problem %s for submission %s: %v", submission.ProblemID, payload.SubmissionID, err)
-		return err
+		return nil, err
 	}
 
 	tempDir, err = r.PrepareEnvironment(payload.SubmissionID, submission.Code, submission.Language)
 	if err != nil {
 		log.Printf("Error preparing environment for %s: %v", payload.SubmissionID, err)
 		result := store.SubmissionResult{Status: store.StatusInternalError}
-		return cb.SendResult(payload.SubmissionID, result)
+		return finish(result)
 	}
 
-	executablePath, compileOutput, err := r.Compile(tempDir, submission.Language)
+	compileOutput, err := r.Compile(tempDir, submission.Language)
+	if err != nil && !errors.Is(err, runner.ErrCompilationFailed) {
+		log.Printf("Error compiling %s: %v", payload.SubmissionID, err)
+		result := store.SubmissionResult{Status: store.StatusInternalError}
+		return finish(result)
+	}
 	if err != nil {
 		log.Printf("Compilation failed for %s. Compiler output: %s", payload.SubmissionID, compileOutput)
 		result := store.SubmissionResult{
 			Status:        store.StatusCompilationError,
 			CompileOutput: compileOutput,
 		}
-		return cb.SendResult(payload.SubmissionID, result)
+		return finish(result)
+	}
+
+	if problem.IsInteractive() && problem.Interactor == nil {
+		log.Printf("Problem %s is interactive but has no interactor", submission.ProblemID.Hex())
+		result := store.SubmissionResult{Status: store.StatusInternalError}
+		return finish(result)
+	}
+	// The message goes to the contestant, so it does not tell the details
+	// of the setter's programs, which are only logged.
+	var checkerMessage string
+	compare, err := core.NewComparator(problem.Checker)
+	if err != nil {
+		err = fmt.Errorf("invalid checker: %w", err)
+		checkerMessage = err.Error()
+	} else if problem.IsInteractive() {
+		interactorDir, err = prepareJudgeProgram(r, "interactor-"+problem.ID.Hex(), problem.Interactor)
+		checkerMessage = "interactor failed to compile"
+	} else if problem.SpecialJudge != nil {
+		checkerDir, err = prepareJudgeProgram(r, "checker-"+problem.ID.Hex(), problem.SpecialJudge)
+		checkerMessage = "checker failed to compile"
+	}
+	if err != nil {
+		log.Printf("Error preparing checker of problem %s for %s: %v", submission.ProblemID.Hex(), payload.SubmissionID, err)
+		result := store.SubmissionResult{
+			Status:         store.StatusCheckerFailure,
+			CheckerMessage: checkerMessage,
+		}
+		return finish(result)
+	}
+
+	var scorer *core.SubtaskScorer
+	if len(problem.Subtasks) > 0 {
+		scorer, err = core.NewSubtaskScorer(problem.Subtasks, len(problem.TestCases))
+		if err != nil {
+			log.Printf("Invalid subtasks in problem %s: %v", submission.ProblemID.Hex(), err)
+			result := store.SubmissionResult{Status: store.StatusInternalError}
+			return finish(result)
+		}
 	}
 
-	var finalStatus = store.StatusAccepted
-	var totalExecTimeMs int
+	// The first failed test decides the verdict. By default judging stops
+	// there; scored problems go on with the tests that can still earn
+	// points, and in run-all mode every test is run.
+	stopOnFailure := scorer == nil && !problem.RunAllTests && !submission.RunAllTests
+	finalResult := store.SubmissionResult{
+		Status:     store.StatusAccepted,
+		TotalTests: len(problem.TestCases),
+	}
+	var totalExecTimeMs, testsRun int
 	var maxMemoryUsedKb uint64
+	var testResults []store.TestResult
 
-	for i, testCase := range problem.TestCases {
-		log.Printf("Running test case %d for submission %s...", i+1, payload.SubmissionID)
-		
-		timeLimitMs := problem.TimeLimit * 1000
-		execResult := r.Execute(executablePath, testCase, timeLimitMs, problem.MemoryLimit)
+	judge := &testJudge{
+		submissionID:  payload.SubmissionID,
+		problem:       problem,
+		language:      submission.Language,
+		programDir:    tempDir,
+		checkerDir:    checkerDir,
+		interactorDir: interactorDir,
+		compare:       compare,
+	}
+	for _, outcome := range runTests(ctx, r, pool, judge, scorer, stopOnFailure) {
+		i, execResult, check := outcome.index, outcome.exec, outcome.check
+		if outcome.skipped {
+			testResults = append(testResults, store.TestResult{Index: i + 1, Status: store.StatusSkipped})
+			continue
+		}
 
 		if execResult.MemoryUsedKb > maxMemoryUsedKb {
 			maxMemoryUsedKb = execResult.MemoryUsedKb
 		}
-		totalExecTimeMs += execResult.ExecutionTimeMs
-
-		if execResult.Status != store.StatusCompleted {
-			finalStatus = execResult.Status
-			log.Printf("Submission %s - Test case %d failed with status: %s", payload.SubmissionID, i+1, finalStatus)
-			result := store.SubmissionResult{
-				Status:        finalStatus,
-				ExecutionTime: execResult.ExecutionTimeMs,
-				MemoryUsed:    execResult.MemoryUsedKb,
-			}
-			return cb.SendResult(payload.SubmissionID, result)
-		}
+		totalExecTimeMs += execResult.CpuTimeMs
+		testsRun++
+		testResults = append(testResults, store.TestResult{
+			Index:          i + 1,
+			Status:         check.Status,
+			ExecutionTime:  execResult.CpuTimeMs,
+			MemoryUsed:     execResult.MemoryUsedKb,
+			ExitCode:       execResult.ExitCode,
+			Score:          check.Score,
+			CheckerMessage: check.Message,
+		})
 
-		if !core.CompareOutputs(execResult.Output, testCase.Output) {
-			finalStatus = store.StatusWrongAnswer
-			log.Printf("Submission %s - Test case %d: Wrong Answer", payload.SubmissionID, i+1)
-			result := store.SubmissionResult{
-				Status:        finalStatus,
-				ExecutionTime: execResult.ExecutionTimeMs,
-				MemoryUsed:    maxMemoryUsedKb,
+		if check.Status != store.StatusAccepted {
+			log.Printf("Submission %s - Test case %d failed with status: %s", payload.SubmissionID, i+1, check.Status)
+			if finalResult.Status == store.StatusAccepted {
+				finalResult.Status = check.Status
+				finalResult.CheckerMessage = check.Message
+				if check.Status == store.StatusRuntimeError {
+					finalResult.Reason = execResult.ExitReason()
+				}
+			}
+			if stopOnFailure {
+				finalResult.ExecutionTime = execResult.CpuTimeMs
+				finalResult.MemoryUsed = maxMemoryUsedKb
+				finalResult.TestResults = testResults
+				return finish(finalResult)
 			}
-			return cb.SendResult(payload.SubmissionID, result)
+			continue
 		}
+		finalResult.PassedTests++
 		log.Printf("Submission %s - Test case %d: Passed", payload.SubmissionID, i+1)
 	}
 
-	var avgExecTimeMs int
-	if len(problem.TestCases) > 0 {
-		avgExecTimeMs = totalExecTimeMs / len(problem.TestCases)
+	if testsRun > 0 {
+		finalResult.ExecutionTime = totalExecTimeMs / testsRun
 	}
+	finalResult.MemoryUsed = maxMemoryUsedKb
+	finalResult.TestResults = testResults
+	if scorer != nil {
+		finalResult.Score, finalResult.Subtasks = scorer.Results()
+		finalResult.MaxScore = scorer.MaxScore()
+		log.Printf("Submission %s scored %g of %g", payload.SubmissionID, finalResult.Score, finalResult.MaxScore)
+	}
+	log.Printf("Finalizing submission %s with status: %s, %d of %d tests passed. Sending to callback.", payload.SubmissionID, finalResult.Status, finalResult.PassedTests, finalResult.TotalTests)
+	return finish(finalResult)
+}
 
-	finalResult := store.SubmissionResult{
-		Status:        finalStatus,
-		ExecutionTime: avgExecTimeMs,
-		MemoryUsed:    maxMemoryUsedKb,
+// prepareJudgeProgram compiles a program that comes with the problem, such
+// as its checker, in a directory of its own, which is returned for cleanup
+// even when compilation fails.
+func prepareJudgeProgram(r *runner.Runner, name string, program *store.ProgramRef) (string, error) {
+	dir, err := r.PrepareEnvironment(name, program.Source, program.Language)
+	if err != nil {
+		return "", err
+	}
+	output, err := r.Compile(dir, program.Language)
+	if err != nil {
+		log.Printf("Compilation of %s failed. Compiler output: %s", name, output)
+		return dir, fmt.Errorf("failed to compile %s: %w", name, err)
+	}
+	return dir, nil
+}
+
+// checkOutput judges the output of one test with the problem's special
+// judge, compiled in checkerDir, or by comparing it with the expected output
+// when the problem has none.
+func checkOutput(r *runner.Runner, problem *store.Problem, checkerDir string, compare core.Comparator, testCase store.TestCase, output string) core.CheckResult {
+	if problem.SpecialJudge == nil {
+		return core.CheckOutput(compare, problem.Checker.StrictLayout, output, testCase.Output)
+	}
+	exitCode, message, err := r.Check(checkerDir, problem.SpecialJudge.Language, testCase, output)
+	if err != nil {
+		log.Printf("Checker of problem %s failed: %v", problem.ID.Hex(), err)
+		return core.CheckResult{Status: store.StatusCheckerFailure, Message: "checker failed"}
 	}
-	log.Printf("Finalizing submission %s with status: %s. Sending to callback.", payload.SubmissionID, finalStatus)
-	return cb.SendResult(payload.SubmissionID, finalResult)
+	return core.CheckerVerdict(exitCode, message)
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"judge-service/internal/core"
+	"judge-service/internal/runner"
+	"judge-service/internal/store"
+)
+
+// testPool is the share of the machine a submission's tests run on.
+type testPool struct {
+	cpus    []int // Split evenly among the workers, whose tests are pinned to their share
+	workers int   // Tests run at once, at most one per CPU
+}
+
+// workerPools divides cpus among the queue's workers, leaving the first
+// reserved CPUs alone. With workers 0, every worker gets parallelTests
+// CPUs and there are as many workers as that allows.
+func workerPools(cpus []int, workers, reserved, parallelTests int) ([]testPool, error) {
+	usable := cpus
+	if len(cpus) > reserved {
+		usable = cpus[reserved:]
+	} else {
+		log.Printf("Warning: only %d CPUs available, not reserving any", len(cpus))
+	}
+	if workers == 0 {
+		workers = max(1, len(usable)/parallelTests)
+	}
+	if workers > len(usable) {
+		return nil, fmt.Errorf("%d workers need as many CPUs, but only %d are available", workers, len(usable))
+	}
+
+	pools := make([]testPool, workers)
+	for w := range pools {
+		pools[w] = testPool{
+			cpus:    usable[w*len(usable)/workers : (w+1)*len(usable)/workers],
+			workers: parallelTests,
+		}
+		log.Printf("Worker %d runs on CPUs %v", w, pools[w].cpus)
+	}
+	return pools, nil
+}
+
+// testJudge runs and judges the test cases of one submission.
+type testJudge struct {
+	submissionID  string
+	problem       *store.Problem
+	language      string
+	programDir    string
+	checkerDir    string
+	interactorDir string
+	compare       core.Comparator
+}
+
+// testOutcome is what became of one test case. Skipped tests were not run.
+type testOutcome struct {
+	index   int
+	skipped bool
+	exec    store.ExecutionResult
+	check   core.CheckResult
+}
+
+// judge runs test case i with r and judges the result.
+func (j *testJudge) judge(r *runner.Runner, i int) (store.ExecutionResult, core.CheckResult) {
+	problem := j.problem
+	testCase := problem.TestCases[i]
+	timeLimitMs := problem.TimeLimit * 1000
+	if problem.IsInteractive() {
+		interaction := r.Interact(j.programDir, j.language, j.interactorDir, problem.Interactor.Language, testCase, timeLimitMs, problem.MemoryLimit, problem.OutputLimit)
+		if interaction.Execution.Status == store.StatusInternalError {
+			log.Printf("Interaction on test case %d of submission %s failed: %s", i+1, j.submissionID, interaction.Execution.Error)
+		} else if interaction.InteractorError != "" {
+			log.Printf("Interactor of problem %s failed on test case %d: %s", problem.ID.Hex(), i+1, interaction.InteractorError)
+		}
+		return interaction.Execution, core.InteractionVerdict(interaction)
+	}
+	execResult := r.Execute(j.programDir, j.language, testCase, timeLimitMs, problem.MemoryLimit, problem.OutputLimit)
+	if execResult.Status != store.StatusCompleted {
+		return execResult, core.CheckResult{Status: execResult.Status}
+	}
+	return execResult, checkOutput(r, problem, j.checkerDir, j.compare, testCase, execResult.Output)
+}
+
+// runTests judges the problem's test cases, up to pool.workers at once,
+// and returns their outcomes in order. Tests are started in order, so the
+// lowest failing test is always among those run, however the runs
+// interleave. With stopOnFailure, tests after the lowest failure found so
+// far are not started, and cancelled if running; they are left out of the
+// outcomes. Tests the scorer finds doomed when their turn comes are skipped.
+func runTests(ctx context.Context, r *runner.Runner, pool testPool, j *testJudge, scorer *core.SubtaskScorer, stopOnFailure bool) []testOutcome {
+	numTests := len(j.problem.TestCases)
+	workers := pool.workers
+	if len(pool.cpus) > 0 && workers > len(pool.cpus) {
+		workers = len(pool.cpus)
+	}
+
+	var (
+		mu           sync.Mutex
+		next         int
+		firstFailure = numTests
+		outcomes     = make([]*testOutcome, numTests)
+		cancels      = make(map[int]context.CancelFunc)
+	)
+	// take returns the next test to run and the context to run it in, or
+	// -1 when there is none.
+	take := func() (int, context.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		for next < numTests && !(stopOnFailure && next > firstFailure) {
+			i := next
+			next++
+			if scorer != nil && scorer.Doomed(i) {
+				log.Printf("Submission %s - Test case %d: Skipped", j.submissionID, i+1)
+				outcomes[i] = &testOutcome{index: i, skipped: true}
+				continue
+			}
+			testCtx, cancel := context.WithCancel(ctx)
+			cancels[i] = cancel
+			return i, testCtx
+		}
+		return -1, nil
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		var cpus []int
+		if len(pool.cpus) > 0 {
+			cpus = pool.cpus[w*len(pool.cpus)/workers : (w+1)*len(pool.cpus)/workers]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, testCtx := take(); i >= 0; i, testCtx = take() {
+				log.Printf("Running test case %d for submission %s...", i+1, j.submissionID)
+				execResult, check := j.judge(r.Bind(testCtx, cpus), i)
+
+				mu.Lock()
+				cancels[i]()
+				delete(cancels, i)
+				if !(stopOnFailure && i > firstFailure) {
+					outcomes[i] = &testOutcome{index: i, exec: execResult, check: check}
+					if scorer != nil {
+						scorer.Record(i, check.Score)
+					}
+					if check.Status != store.StatusAccepted && i < firstFailure {
+						firstFailure = i
+						if stopOnFailure {
+							for k, cancelTest := range cancels {
+								if k > i {
+									cancelTest()
+								}
+							}
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var results []testOutcome
+	for _, outcome := range outcomes {
+		if outcome != nil && !(stopOnFailure && outcome.index > firstFailure) {
+			results = append(results, *outcome)
+		}
+	}
+	return results
+}
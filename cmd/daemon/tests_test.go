@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorkerPools(t *testing.T) {
+	cpus := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	tests := []struct {
+		name          string
+		cpus          []int
+		workers       int
+		reserved      int
+		parallelTests int
+		want          [][]int // CPUs of each worker
+	}{
+		{"one worker", cpus, 1, 0, 1, [][]int{cpus}},
+		{"even split", cpus, 4, 0, 1, [][]int{{0, 1}, {2, 3}, {4, 5}, {6, 7}}},
+		{"uneven split", cpus, 3, 0, 1, [][]int{{0, 1}, {2, 3, 4}, {5, 6, 7}}},
+		{"reserved", cpus, 2, 2, 1, [][]int{{2, 3, 4}, {5, 6, 7}}},
+		{"as many as the CPUs", []int{4, 6}, 2, 0, 1, [][]int{{4}, {6}}},
+		{"workers from parallel tests", cpus, 0, 1, 3, [][]int{{1, 2, 3}, {4, 5, 6, 7}}},
+		{"at least one worker", cpus, 0, 0, 16, [][]int{cpus}},
+		{"too few to reserve", []int{0, 1}, 1, 2, 1, [][]int{{0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools, err := workerPools(tt.cpus, tt.workers, tt.reserved, tt.parallelTests)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]int
+			for _, pool := range pools {
+				got = append(got, pool.cpus)
+				if pool.workers != tt.parallelTests {
+					t.Errorf("pool on CPUs %v runs %d tests at once, want %d", pool.cpus, pool.workers, tt.parallelTests)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("workers run on CPUs %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolsTooManyWorkers(t *testing.T) {
+	if pools, err := workerPools([]int{0, 1, 2, 3}, 3, 2, 1); err == nil {
+		t.Errorf("workerPools succeeded with %d pools, want an error", len(pools))
+	}
+}
@@ -0,0 +1,131 @@
+// Command deadletters inspects the jobs the judge daemon gave up on and puts
+// them back on the queue.
+//
+// Usage:
+//
+//	deadletters list
+//	deadletters requeue <submission-id>...
+//	deadletters requeue -all
+//
+// Dead letters exist in QUEUE_MODE list only; the command refuses to run in
+// BullMQ mode.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"judge-service/internal/config"
+	"judge-service/internal/queue"
+	"judge-service/internal/store"
+
+	"github.com/joho/godotenv"
+)
+
+func init() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found or error loading .env file")
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var all bool
+	var ids []string
+	switch os.Args[1] {
+	case "list":
+		if len(os.Args) > 2 {
+			usage()
+		}
+	case "requeue":
+		flags := flag.NewFlagSet("requeue", flag.ExitOnError)
+		flags.Usage = usage
+		flags.BoolVar(&all, "all", false, "requeue every dead letter")
+		flags.Parse(os.Args[2:])
+		ids = flags.Args()
+		if all == (len(ids) > 0) {
+			usage()
+		}
+	default:
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Queue.Mode != config.QueueModeList {
+		log.Fatalf("Dead letters are kept in QUEUE_MODE %s only; BullMQ keeps failed jobs in its own failed set", config.QueueModeList)
+	}
+	consumer, err := queue.NewConsumer(cfg.RedisURL, 0, cfg.Queue)
+	if err != nil {
+		log.Fatalf("Could not initialize queue consumer: %v", err)
+	}
+
+	ctx := context.Background()
+	letters, err := consumer.DeadLetters(ctx)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if os.Args[1] == "list" {
+		for _, letter := range letters {
+			printLetter(letter)
+		}
+		fmt.Printf("%d dead letters\n", len(letters))
+		return
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	requeued := 0
+	for _, letter := range letters {
+		id := submissionID(letter)
+		if !all && !wanted[id] {
+			continue
+		}
+		ok, err := consumer.RequeueDeadLetter(ctx, letter)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if ok {
+			fmt.Printf("Requeued submission %s\n", id)
+			requeued++
+		}
+	}
+	fmt.Printf("%d dead letters requeued\n", requeued)
+}
+
+// printLetter prints a dead letter with its attempts.
+func printLetter(letter queue.DeadLetter) {
+	fmt.Printf("Submission %s from queue %s, died %s after %d attempts: %s\n",
+		submissionID(letter), letter.Queue, letter.DiedAt.Format(time.RFC3339), len(letter.Attempts), letter.LastError)
+	for i, attempt := range letter.Attempts {
+		fmt.Printf("  %d. %s: %s\n", i+1, attempt.FailedAt.Format(time.RFC3339), attempt.Error)
+	}
+	fmt.Printf("  Payload: %s\n", letter.Payload)
+}
+
+// submissionID returns the submission a dead letter is for, or "?" if its
+// payload names none.
+func submissionID(letter queue.DeadLetter) string {
+	var payload store.SubmissionPayload
+	if err := json.Unmarshal([]byte(letter.Payload), &payload); err != nil || payload.SubmissionID == "" {
+		return "?"
+	}
+	return payload.SubmissionID
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: deadletters list | deadletters requeue <submission-id>... | deadletters requeue -all")
+	os.Exit(2)
+}
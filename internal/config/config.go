@@ -3,6 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Config holds all configuration loaded from environment variables.
@@ -13,6 +17,93 @@ type Config struct {
 	MongoDBName       string
 	InternalApiUrl    string // URL for the callback API
 	InternalApiSecret string // Secret for the callback API
+	Queue             QueueConfig
+	Sandbox           SandboxConfig
+
+	// Workers is the number of submissions judged at once, each on its own
+	// set of CPUs; 0 makes it as many as the CPUs left after ReservedCPUs
+	// allow with Sandbox.ParallelTests CPUs each. The first ReservedCPUs
+	// CPUs are kept free for the daemon itself and other services.
+	Workers      int
+	ReservedCPUs int
+}
+
+// Formats of the queues jobs are taken from.
+const (
+	QueueModeList   = "list"   // Redis lists of JSON payloads
+	QueueModeBullMQ = "bullmq" // BullMQ queues, the payload being the job data
+)
+
+// Policies for choosing the queue the next job is taken from.
+const (
+	QueuePolicyStrict   = "strict"   // Take from a queue only when all before it are empty
+	QueuePolicyWeighted = "weighted" // Take from busy queues in proportion to their weights
+)
+
+// NamedQueue is a queue jobs are taken from.
+type NamedQueue struct {
+	Name   string
+	Weight int // Share of the jobs taken under QueuePolicyWeighted
+}
+
+// QueueConfig holds the settings of the job queue consumer.
+type QueueConfig struct {
+	Mode string // QueueModeList or QueueModeBullMQ
+
+	// Queues are the queues jobs are taken from, highest priority first,
+	// by default just Config.RedisQueueName. Policy decides how they share
+	// the workers.
+	Queues []NamedQueue
+	Policy string
+
+	// ConsumerID names this daemon's processing lists. It must be unique
+	// among the daemons on a queue, and a daemon restarted under the same
+	// ID takes its unfinished jobs back at once.
+	ConsumerID string
+
+	// A worker's unfinished jobs go back on the queue once it has not sent
+	// a heartbeat for this long.
+	HeartbeatTimeoutMs int
+
+	// A failed job is retried after RetryBackoffMs, doubling with every
+	// further failure up to RetryBackoffMaxMs. After MaxAttempts failures
+	// it goes to the dead-letter list instead.
+	MaxAttempts       int
+	RetryBackoffMs    int
+	RetryBackoffMaxMs int
+
+	// In QueueModeBullMQ, BullMQ's own keys, attempts and backoff are used
+	// instead. A job's lock lasts LockDurationMs unless renewed, and a job
+	// whose lock lapses more than MaxStalledCount times fails.
+	BullMQPrefix    string
+	LockDurationMs  int
+	MaxStalledCount int
+}
+
+// SandboxConfig holds the settings of the code execution sandbox.
+type SandboxConfig struct {
+	CgroupRoot string // Delegated cgroup v2 directory for per-run leaves
+
+	// The wall-clock limit of a run is CPU limit * WallTimeMultiplier + WallTimeExtraMs.
+	WallTimeMultiplier float64
+	WallTimeExtraMs    int
+
+	OutputLimitMb int // Default stdout limit for problems that do not set one
+	StderrLimitKb int // Stderr kept per run; the rest is discarded
+
+	CompileOutputLimitKb int // Compiler messages kept; the rest is discarded
+
+	CompileCacheDir   string // Where compiled artifacts are cached
+	CompileCacheMaxMb int    // Size cap of the compile cache, 0 to disable it
+
+	CheckerTimeLimitMs   int // CPU time a special judge may take per test
+	CheckerMemoryLimitMb int // Memory a special judge may use per test
+
+	// CPUs are the cores runs are confined to, empty for all the cgroup
+	// root allows. ParallelTests of a submission's tests run at once, each
+	// on its own share of them.
+	CPUs          []int
+	ParallelTests int
 }
 
 // Load reads configuration from environment variables.
@@ -24,6 +115,14 @@ func Load() (*Config, error) {
 		MongoDBName:       os.Getenv("MONGO_DB_NAME"),
 		InternalApiUrl:    os.Getenv("INTERNAL_API_URL"),
 		InternalApiSecret: os.Getenv("INTERNAL_API_SECRET"),
+		Queue: QueueConfig{
+			Mode:         os.Getenv("QUEUE_MODE"),
+			ConsumerID:   os.Getenv("QUEUE_CONSUMER_ID"),
+			BullMQPrefix: os.Getenv("BULLMQ_PREFIX"),
+		},
+		Sandbox: SandboxConfig{
+			CgroupRoot: os.Getenv("CGROUP_ROOT"),
+		},
 	}
 
 	if cfg.MongoURI == "" {
@@ -38,33 +137,233 @@ func Load() (*Config, error) {
 	if cfg.RedisQueueName == "" {
 		cfg.RedisQueueName = "submission_queue" // Default value
 	}
+	switch cfg.Queue.Mode {
+	case "":
+		cfg.Queue.Mode = QueueModeList // Default value
+	case QueueModeList, QueueModeBullMQ:
+	default:
+		return nil, fmt.Errorf("QUEUE_MODE must be %q or %q", QueueModeList, QueueModeBullMQ)
+	}
+	if cfg.Queue.BullMQPrefix == "" {
+		cfg.Queue.BullMQPrefix = "bull" // Default value
+	}
+	if cfg.Queue.ConsumerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("QUEUE_CONSUMER_ID environment variable not set and hostname unavailable: %w", err)
+		}
+		cfg.Queue.ConsumerID = hostname // Default value
+	}
 	if cfg.InternalApiUrl == "" {
 		return nil, fmt.Errorf("INTERNAL_API_URL environment variable not set")
 	}
 	if cfg.InternalApiSecret == "" {
 		return nil, fmt.Errorf("INTERNAL_API_SECRET environment variable not set")
 	}
+	if cfg.Sandbox.CgroupRoot == "" {
+		cfg.Sandbox.CgroupRoot = "/sys/fs/cgroup/judge" // Default value
+	}
+
+	var err error
+	if cfg.Queue.Queues, err = parseQueues(os.Getenv("REDIS_QUEUES")); err != nil {
+		return nil, fmt.Errorf("invalid REDIS_QUEUES: %w", err)
+	}
+	if len(cfg.Queue.Queues) == 0 {
+		cfg.Queue.Queues = []NamedQueue{{Name: cfg.RedisQueueName, Weight: 1}} // Default value
+	}
+	cfg.Queue.Policy = os.Getenv("QUEUE_POLICY")
+	switch cfg.Queue.Policy {
+	case "":
+		cfg.Queue.Policy = QueuePolicyStrict // Default value
+	case QueuePolicyStrict, QueuePolicyWeighted:
+	default:
+		return nil, fmt.Errorf("QUEUE_POLICY must be %q or %q", QueuePolicyStrict, QueuePolicyWeighted)
+	}
+	if cfg.Workers, err = getEnvInt("JUDGE_WORKERS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ReservedCPUs, err = getEnvInt("RESERVED_CPUS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.Workers < 0 || cfg.ReservedCPUs < 0 {
+		return nil, fmt.Errorf("JUDGE_WORKERS and RESERVED_CPUS must not be negative")
+	}
+	if cfg.Queue.HeartbeatTimeoutMs, err = getEnvInt("QUEUE_HEARTBEAT_TIMEOUT_MS", 30000); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.HeartbeatTimeoutMs < 1000 {
+		return nil, fmt.Errorf("QUEUE_HEARTBEAT_TIMEOUT_MS must be at least 1000")
+	}
+	if cfg.Queue.MaxAttempts, err = getEnvInt("QUEUE_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.MaxAttempts < 1 {
+		return nil, fmt.Errorf("QUEUE_MAX_ATTEMPTS must be at least 1")
+	}
+	if cfg.Queue.RetryBackoffMs, err = getEnvInt("QUEUE_RETRY_BACKOFF_MS", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.RetryBackoffMaxMs, err = getEnvInt("QUEUE_RETRY_BACKOFF_MAX_MS", 300000); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.RetryBackoffMs < 0 || cfg.Queue.RetryBackoffMaxMs < cfg.Queue.RetryBackoffMs {
+		return nil, fmt.Errorf("QUEUE_RETRY_BACKOFF_MS must not be negative nor above QUEUE_RETRY_BACKOFF_MAX_MS")
+	}
+	if cfg.Queue.LockDurationMs, err = getEnvInt("BULLMQ_LOCK_DURATION_MS", 30000); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.LockDurationMs < 1000 {
+		return nil, fmt.Errorf("BULLMQ_LOCK_DURATION_MS must be at least 1000")
+	}
+	if cfg.Queue.MaxStalledCount, err = getEnvInt("BULLMQ_MAX_STALLED_COUNT", 1); err != nil {
+		return nil, err
+	}
+	if cfg.Queue.MaxStalledCount < 0 {
+		return nil, fmt.Errorf("BULLMQ_MAX_STALLED_COUNT must not be negative")
+	}
+	if cfg.Sandbox.WallTimeMultiplier, err = getEnvFloat("WALL_TIME_MULTIPLIER", 3); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.WallTimeMultiplier < 1 {
+		return nil, fmt.Errorf("WALL_TIME_MULTIPLIER must be at least 1")
+	}
+	if cfg.Sandbox.WallTimeExtraMs, err = getEnvInt("WALL_TIME_EXTRA_MS", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.WallTimeExtraMs < 0 {
+		return nil, fmt.Errorf("WALL_TIME_EXTRA_MS must not be negative")
+	}
+	if cfg.Sandbox.OutputLimitMb, err = getEnvInt("OUTPUT_LIMIT_MB", 64); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.StderrLimitKb, err = getEnvInt("STDERR_LIMIT_KB", 64); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.CompileOutputLimitKb, err = getEnvInt("COMPILE_OUTPUT_LIMIT_KB", 64); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.OutputLimitMb < 1 || cfg.Sandbox.StderrLimitKb < 1 || cfg.Sandbox.CompileOutputLimitKb < 1 {
+		return nil, fmt.Errorf("OUTPUT_LIMIT_MB, STDERR_LIMIT_KB and COMPILE_OUTPUT_LIMIT_KB must be positive")
+	}
+	cfg.Sandbox.CompileCacheDir = os.Getenv("COMPILE_CACHE_DIR")
+	if cfg.Sandbox.CompileCacheDir == "" {
+		cfg.Sandbox.CompileCacheDir = filepath.Join(os.TempDir(), "judge-compile-cache") // Default value
+	}
+	if cfg.Sandbox.CompileCacheMaxMb, err = getEnvInt("COMPILE_CACHE_MAX_MB", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.CompileCacheMaxMb < 0 {
+		return nil, fmt.Errorf("COMPILE_CACHE_MAX_MB must not be negative")
+	}
+	if cfg.Sandbox.CheckerTimeLimitMs, err = getEnvInt("CHECKER_TIME_LIMIT_MS", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.CheckerMemoryLimitMb, err = getEnvInt("CHECKER_MEMORY_LIMIT_MB", 512); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.CheckerTimeLimitMs < 1 || cfg.Sandbox.CheckerMemoryLimitMb < 1 {
+		return nil, fmt.Errorf("CHECKER_TIME_LIMIT_MS and CHECKER_MEMORY_LIMIT_MB must be positive")
+	}
+	if cfg.Sandbox.CPUs, err = ParseCPUList(os.Getenv("JUDGE_CPUS")); err != nil {
+		return nil, fmt.Errorf("invalid JUDGE_CPUS: %w", err)
+	}
+	if cfg.Sandbox.ParallelTests, err = getEnvInt("PARALLEL_TESTS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.Sandbox.ParallelTests < 1 {
+		return nil, fmt.Errorf("PARALLEL_TESTS must be at least 1")
+	}
 
 	return cfg, nil
 }
 
+// ParseCPUList parses a list of CPUs in the kernel's format, such as
+// "0-3,6", into sorted, distinct CPU numbers. An empty list yields nil.
+func ParseCPUList(list string) ([]int, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid CPU %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("invalid CPU range %q", part)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// parseQueues parses a comma-separated list of queue names, highest
+// priority first, each optionally followed by a colon and its weight, such
+// as "contest:8,rejudge,practice:3". Weights default to 1. An empty list
+// yields nil.
+func parseQueues(list string) ([]NamedQueue, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	var queues []NamedQueue
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(list, ",") {
+		name, weight, hasWeight := strings.Cut(strings.TrimSpace(part), ":")
+		queue := NamedQueue{Name: name, Weight: 1}
+		if name == "" {
+			return nil, fmt.Errorf("empty queue name in %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("queue %s listed twice", name)
+		}
+		seen[name] = true
+		if hasWeight {
+			var err error
+			if queue.Weight, err = strconv.Atoi(weight); err != nil || queue.Weight < 1 {
+				return nil, fmt.Errorf("invalid weight %q of queue %s", weight, name)
+			}
+		}
+		queues = append(queues, queue)
+	}
+	return queues, nil
+}
 
-// Language defines the compilation and execution properties for a language.
-type Language struct {
-	SourceFileName     string `json:"sourceFileName"`
-	ExecutableFileName string `json:"executableFileName"`
-	CompileCmd         string `json:"compileCmd,omitempty"`
+// getEnvInt reads an integer environment variable, falling back to def when unset.
+func getEnvInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
 }
 
-// LoadLanguageConfig loads language definitions.
-func LoadLanguageConfig() (map[string]Language, error) {
-	languages := make(map[string]Language)
-	
-	languages["cpp"] = Language{
-		SourceFileName:     "main.cpp",
-		ExecutableFileName: "main",
-		CompileCmd:         "g++ main.cpp -o main -O2 -std=c++17",
-	}
-	
-	return languages, nil
+// getEnvFloat reads a float environment variable, falling back to def when unset.
+func getEnvFloat(name string, def float64) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return f, nil
 }
+
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "\n", want: nil},
+		{list: "3", want: []int{3}},
+		{list: "0-3,6", want: []int{0, 1, 2, 3, 6}},
+		{list: "8-9, 2 ,4-4", want: []int{2, 4, 8, 9}},
+		{list: "0-2,1-3,2", want: []int{0, 1, 2, 3}},
+		{list: "0-3\n", want: []int{0, 1, 2, 3}},
+		{list: "a", wantErr: true},
+		{list: "-1", wantErr: true},
+		{list: "3-1", wantErr: true},
+		{list: "1-", wantErr: true},
+		{list: "0,,1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCPUList(tt.list)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCPUList(%q) = %v, want an error", tt.list, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCPUList(%q): %v", tt.list, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCPUList(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueues(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []NamedQueue
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "  ", want: nil},
+		{list: "submissions", want: []NamedQueue{{Name: "submissions", Weight: 1}}},
+		{list: "contest:8, rejudge ,practice:3", want: []NamedQueue{{"contest", 8}, {"rejudge", 1}, {"practice", 3}}},
+		{list: "contest,", wantErr: true},
+		{list: ":2", wantErr: true},
+		{list: "contest,contest:2", wantErr: true},
+		{list: "contest:0", wantErr: true},
+		{list: "contest:-1", wantErr: true},
+		{list: "contest:high", wantErr: true},
+		{list: "contest:", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueues(tt.list)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseQueues(%q) = %v, want an error", tt.list, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQueues(%q): %v", tt.list, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQueues(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+// setRequiredEnv sets the environment variables Load cannot do without.
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+	t.Setenv("REDIS_URL", "redis://localhost:6379")
+	t.Setenv("INTERNAL_API_URL", "http://localhost:3000")
+	t.Setenv("INTERNAL_API_SECRET", "secret")
+}
+
+func TestLoadLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"WALL_TIME_EXTRA_MS", "0", false},
+		{"WALL_TIME_EXTRA_MS", "-1", true},
+		{"OUTPUT_LIMIT_MB", "0", true},
+		{"STDERR_LIMIT_KB", "-64", true},
+		{"COMPILE_OUTPUT_LIMIT_KB", "0", true},
+		{"COMPILE_CACHE_MAX_MB", "0", false},
+		{"COMPILE_CACHE_MAX_MB", "-1", true},
+		{"CHECKER_TIME_LIMIT_MS", "1", false},
+		{"CHECKER_TIME_LIMIT_MS", "0", true},
+		{"CHECKER_TIME_LIMIT_MS", "-10000", true},
+		{"CHECKER_MEMORY_LIMIT_MB", "0", true},
+		{"CHECKER_MEMORY_LIMIT_MB", "-512", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv(tt.name, tt.value)
+			_, err := Load()
+			if tt.wantErr && err == nil {
+				t.Errorf("Load() succeeded, want an error")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Load(): %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Language defines the compilation and execution properties for a language.
+type Language struct {
+	DisplayName    string `json:"displayName"`          // Shown to users, e.g. "C++17 (GCC)"
+	Version        string `json:"version"`              // Informational toolchain version, e.g. "11.4"
+	SourceFileName string `json:"sourceFileName"`       // Name the submission is saved under
+	CompileCmd     string `json:"compileCmd,omitempty"` // Shell command run in the work dir, e.g. a build or syntax check
+	VersionCmd     string `json:"versionCmd,omitempty"` // Prints the compiler version, part of the compile cache key
+
+	// RunCmd is the program and arguments started for each test, resolved
+	// in the work dir, e.g. ["./main"] or ["python3", "main.py"].
+	// CompileCmd and RunCmd may use the placeholders {sourceFile},
+	// {mainClass} (the source file name without extension) and {memoryMb}
+	// (the memory limit without MemoryOverheadMb, e.g. for -Xmx). In
+	// CompileCmd they are shell-quoted.
+	RunCmd []string          `json:"runCmd"`
+	Env    map[string]string `json:"env,omitempty"` // Added to the program's environment
+
+	// MainClassPattern is a regular expression whose first group finds the
+	// class a source must be saved after, like Java's public class. It is
+	// matched with comments and string literals left out, and a name other
+	// than [A-Za-z_][A-Za-z0-9_]* is not used. The source keeps the
+	// extension of SourceFileName.
+	MainClassPattern string `json:"mainClassPattern,omitempty"`
+
+	// Mounts are extra host paths the toolchain needs, made visible
+	// read-only to both the compiler and the program.
+	Mounts []string `json:"mounts,omitempty"`
+
+	// OutOfMemoryMarker is stderr output by which the runtime reports
+	// exhausting its own heap, e.g. "java.lang.OutOfMemoryError". Such runs
+	// are judged Memory Limit Exceeded instead of Runtime Error.
+	OutOfMemoryMarker string `json:"outOfMemoryMarker,omitempty"`
+
+	// The problem's limits are scaled by these for slower runtimes.
+	TimeMultiplier   float64 `json:"timeMultiplier,omitempty"`
+	MemoryMultiplier float64 `json:"memoryMultiplier,omitempty"`
+
+	// MemoryOverheadMb is what the runtime itself needs before running any
+	// submission code, e.g. a loaded interpreter. It is added to the memory
+	// limit and subtracted from the reported usage.
+	MemoryOverheadMb int `json:"memoryOverheadMb,omitempty"`
+
+	SeccompProfile string `json:"seccompProfile"` // Syscall allowlist the program runs under
+	MaxProcesses   int    `json:"maxProcesses"`   // Processes and threads the program may have at once
+
+	Compile CompileLimits `json:"compile"`
+}
+
+// CompileLimits bounds the resources of a language's compiler.
+type CompileLimits struct {
+	TimeLimitMs   int `json:"timeLimitMs"`   // CPU time of the compiler and its subprocesses
+	MemoryLimitMb int `json:"memoryLimitMb"` // Peak memory of the whole compilation
+	OutputLimitMb int `json:"outputLimitMb"` // Largest file the compiler may write
+	MaxProcesses  int `json:"maxProcesses"`  // Processes and threads alive at once
+}
+
+// EnvList returns Env as sorted KEY=value pairs.
+func (l Language) EnvList() []string {
+	env := make([]string, 0, len(l.Env))
+	for k, v := range l.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// LoadLanguageConfig loads language definitions from the JSON file named by
+// LANGUAGES_FILE (default "languages.json"), keyed by the language ID that
+// submissions use.
+func LoadLanguageConfig() (map[string]Language, error) {
+	path := os.Getenv("LANGUAGES_FILE")
+	if path == "" {
+		path = "languages.json" // Default value
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read language file: %w", err)
+	}
+	var languages map[string]Language
+	if err := json.Unmarshal(data, &languages); err != nil {
+		return nil, fmt.Errorf("failed to parse language file %s: %w", path, err)
+	}
+	if len(languages) == 0 {
+		return nil, fmt.Errorf("no languages defined in %s", path)
+	}
+
+	for id, lang := range languages {
+		if lang.TimeMultiplier == 0 {
+			lang.TimeMultiplier = 1
+		}
+		if lang.MemoryMultiplier == 0 {
+			lang.MemoryMultiplier = 1
+		}
+		if err := lang.validate(); err != nil {
+			return nil, fmt.Errorf("language %s: %w", id, err)
+		}
+		languages[id] = lang
+	}
+	return languages, nil
+}
+
+// placeholders are those CompileCmd and RunCmd may use.
+var placeholders = map[string]bool{"{sourceFile}": true, "{mainClass}": true, "{memoryMb}": true}
+
+// placeholderPattern finds placeholders in a command, and shell parameters
+// such as ${HOME}, which are no placeholders.
+var placeholderPattern = regexp.MustCompile(`\$?\{[A-Za-z]+\}`)
+
+func (l Language) validate() error {
+	if l.DisplayName == "" {
+		return fmt.Errorf("displayName is required")
+	}
+	if l.SourceFileName == "" || strings.ContainsAny(l.SourceFileName, "/\\") {
+		return fmt.Errorf("sourceFileName must be a plain file name")
+	}
+	if len(l.RunCmd) == 0 || l.RunCmd[0] == "" {
+		return fmt.Errorf("runCmd is required")
+	}
+	for _, cmd := range append([]string{l.CompileCmd}, l.RunCmd...) {
+		for _, name := range placeholderPattern.FindAllString(cmd, -1) {
+			if !strings.HasPrefix(name, "$") && !placeholders[name] {
+				return fmt.Errorf("unknown placeholder %s in %q", name, cmd)
+			}
+		}
+	}
+	for k := range l.Env {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("invalid environment variable name %q", k)
+		}
+	}
+	if l.TimeMultiplier < 0 || l.MemoryMultiplier < 0 {
+		return fmt.Errorf("multipliers must not be negative")
+	}
+	if l.MemoryOverheadMb < 0 {
+		return fmt.Errorf("memoryOverheadMb must not be negative")
+	}
+	if l.MainClassPattern != "" {
+		re, err := regexp.Compile(l.MainClassPattern)
+		if err != nil {
+			return fmt.Errorf("invalid mainClassPattern: %w", err)
+		}
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("mainClassPattern must have a group capturing the class name")
+		}
+	}
+	for _, path := range l.Mounts {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("mount %q must be an absolute path", path)
+		}
+	}
+	if l.SeccompProfile == "" {
+		return fmt.Errorf("seccompProfile is required")
+	}
+	if l.MaxProcesses < 1 {
+		return fmt.Errorf("maxProcesses must be at least 1")
+	}
+	if l.CompileCmd != "" && (l.Compile.TimeLimitMs <= 0 || l.Compile.MemoryLimitMb <= 0 || l.Compile.OutputLimitMb <= 0 || l.Compile.MaxProcesses < 1) {
+		return fmt.Errorf("compile limits must all be positive")
+	}
+	return nil
+}
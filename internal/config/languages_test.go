@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validLanguage is a language definition that passes validation, in JSON.
+const validLanguage = `{
+	"displayName": "Java",
+	"sourceFileName": "Main.java",
+	"mainClassPattern": "public\\s+class\\s+([A-Za-z_][A-Za-z0-9_]*)",
+	"compileCmd": "cd ${PWD} && javac {sourceFile}",
+	"runCmd": ["java", "-Xmx{memoryMb}m", "{mainClass}"],
+	"seccompProfile": "jvm",
+	"maxProcesses": 64,
+	"compile": {"timeLimitMs": 10000, "memoryLimitMb": 512, "outputLimitMb": 64, "maxProcesses": 64}
+}`
+
+// loadLanguages loads a language file holding data.
+func loadLanguages(t *testing.T, data string) (map[string]Language, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "languages.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LANGUAGES_FILE", path)
+	return LoadLanguageConfig()
+}
+
+func TestLoadLanguageConfig(t *testing.T) {
+	languages, err := loadLanguages(t, `{"java": `+validLanguage+`}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	java, ok := languages["java"]
+	if !ok {
+		t.Fatalf("loaded %v, want java", languages)
+	}
+	if java.TimeMultiplier != 1 || java.MemoryMultiplier != 1 {
+		t.Errorf("unset multipliers loaded as %v and %v, want 1", java.TimeMultiplier, java.MemoryMultiplier)
+	}
+}
+
+func TestLoadLanguageConfigShipped(t *testing.T) {
+	t.Setenv("LANGUAGES_FILE", filepath.Join("..", "..", "languages.json"))
+	if _, err := LoadLanguageConfig(); err != nil {
+		t.Errorf("languages.json: %v", err)
+	}
+}
+
+func TestLoadLanguageConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string // In validLanguage
+		wantErr string
+	}{
+		{"unknown placeholder in runCmd", [2]string{`"{mainClass}"`, `"{className}"`}, "unknown placeholder {className}"},
+		{"unknown placeholder in compileCmd", [2]string{`{sourceFile}"`, `{sourceFile} {output}"`}, "unknown placeholder {output}"},
+		{"missing displayName", [2]string{`"displayName": "Java",`, ``}, "displayName is required"},
+		{"missing runCmd", [2]string{`"runCmd": ["java", "-Xmx{memoryMb}m", "{mainClass}"],`, ``}, "runCmd is required"},
+		{"missing seccompProfile", [2]string{`"seccompProfile": "jvm",`, ``}, "seccompProfile is required"},
+		{"source file in a directory", [2]string{`"Main.java"`, `"src/Main.java"`}, "sourceFileName"},
+		{"negative time multiplier", [2]string{`"maxProcesses": 64,`, `"maxProcesses": 64, "timeMultiplier": -1,`}, "multipliers must not be negative"},
+		{"negative memory multiplier", [2]string{`"maxProcesses": 64,`, `"maxProcesses": 64, "memoryMultiplier": -0.5,`}, "multipliers must not be negative"},
+		{"pattern without group", [2]string{`([A-Za-z_][A-Za-z0-9_]*)`, `[A-Za-z_]+`}, "mainClassPattern must have a group"},
+		{"missing compile limits", [2]string{`"timeLimitMs": 10000, `, ``}, "compile limits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := strings.Replace(validLanguage, tt.replace[0], tt.replace[1], 1)
+			if lang == validLanguage {
+				t.Fatalf("%q not found in the valid language", tt.replace[0])
+			}
+			_, err := loadLanguages(t, `{"java": `+lang+`}`)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadLanguageConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadLanguageConfigFile(t *testing.T) {
+	for _, data := range []string{"", "{}", `{"java": `, `["java"]`} {
+		if _, err := loadLanguages(t, data); err == nil {
+			t.Errorf("LoadLanguageConfig of %q succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"judge-service/internal/store"
+)
+
+// Exit codes of testlib checkers.
+const (
+	testlibOK            = 0
+	testlibWrongAnswer   = 1
+	testlibPresentation  = 2
+	testlibFail          = 3
+	testlibDirt          = 4
+	testlibPoints        = 7
+	testlibUnexpectedEOF = 8
+	testlibPartialBase   = 0x10 // _pc(n) exits with testlibPartialBase + n
+)
+
+// CheckResult is the verdict on the output of one test.
+type CheckResult struct {
+	Status  string  // Accepted, Wrong Answer, Presentation Error, Partial or Checker Failure
+	Score   float64 // Fraction of the test's points earned, between 0 and 1
+	Message string  // Explanation from the checker, if any
+}
+
+// CheckerVerdict maps the exit code of a testlib-compatible checker to a
+// verdict. message is what the checker printed; for partial scores testlib
+// prints it as "points <score> <comment>". Partial credit from _pc(n) is
+// taken as n percent of the test.
+func CheckerVerdict(exitCode int, message string) CheckResult {
+	message = strings.TrimSpace(message)
+	if exitCode >= testlibPartialBase && exitCode <= 0xff {
+		score := float64(exitCode-testlibPartialBase) / 100
+		if score >= 1 {
+			return CheckResult{Status: store.StatusAccepted, Score: 1, Message: message}
+		}
+		return CheckResult{Status: store.StatusPartial, Score: score, Message: message}
+	}
+	switch exitCode {
+	case testlibOK:
+		return CheckResult{Status: store.StatusAccepted, Score: 1, Message: message}
+	case testlibWrongAnswer:
+		return CheckResult{Status: store.StatusWrongAnswer, Message: message}
+	case testlibPresentation, testlibDirt, testlibUnexpectedEOF:
+		return CheckResult{Status: store.StatusPresentationError, Message: message}
+	case testlibFail:
+		return CheckResult{Status: store.StatusCheckerFailure, Message: message}
+	case testlibPoints:
+		score, err := parsePoints(message)
+		if err != nil {
+			return CheckResult{Status: store.StatusCheckerFailure, Message: err.Error()}
+		}
+		if score >= 1 {
+			return CheckResult{Status: store.StatusAccepted, Score: 1, Message: message}
+		}
+		return CheckResult{Status: store.StatusPartial, Score: score, Message: message}
+	default:
+		return CheckResult{
+			Status:  store.StatusCheckerFailure,
+			Message: fmt.Sprintf("checker exited with unexpected code %d: %s", exitCode, message),
+		}
+	}
+}
+
+// parsePoints reads the score from a testlib "points" message. Negative and NaN
+// scores count as 0.
+func parsePoints(message string) (float64, error) {
+	fields := strings.Fields(strings.TrimPrefix(message, "points"))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("checker reported points without a score")
+	}
+	score, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("checker reported an invalid score %q", fields[0])
+	}
+	if score < 0 || math.IsNaN(score) {
+		score = 0
+	}
+	return score, nil
+}
+
+// InteractionVerdict decides an interactive test from the outcomes of both
+// the submission and the interactor. A limit the submission exceeded or its
+// crash decides the test, except for a submission killed by SIGPIPE after
+// the interactor had already rejected it and stopped reading. An
+// interactor that failed or gave no verdict makes it a Checker Failure.
+// The message goes to the contestant, so it leaves out why the run or the
+// interactor failed; the caller logs that.
+func InteractionVerdict(res store.InteractionResult) CheckResult {
+	execution := res.Execution
+	if execution.Status == store.StatusInternalError {
+		return CheckResult{Status: store.StatusInternalError}
+	}
+	if res.InteractorError != "" {
+		return CheckResult{Status: store.StatusCheckerFailure, Message: "interactor failed"}
+	}
+
+	verdict := CheckerVerdict(res.InteractorExitCode, res.InteractorMessage)
+	if verdict.Status == store.StatusCheckerFailure || execution.Status == store.StatusCompleted {
+		return verdict
+	}
+	brokenPipe := execution.Status == store.StatusRuntimeError && execution.Signal == int(syscall.SIGPIPE)
+	if brokenPipe && verdict.Status != store.StatusAccepted {
+		return verdict
+	}
+	return CheckResult{Status: execution.Status, Message: verdict.Message}
+}
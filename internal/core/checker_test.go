@@ -0,0 +1,153 @@
+package core
+
+import (
+	"math"
+	"syscall"
+	"testing"
+
+	"judge-service/internal/store"
+)
+
+func TestInteractionVerdict(t *testing.T) {
+	completed := store.ExecutionResult{Status: store.StatusCompleted}
+	brokenPipe := store.ExecutionResult{Status: store.StatusRuntimeError, ExitCode: -1, Signal: int(syscall.SIGPIPE)}
+	segfault := store.ExecutionResult{Status: store.StatusRuntimeError, ExitCode: -1, Signal: int(syscall.SIGSEGV)}
+	timeLimit := store.ExecutionResult{Status: store.StatusTimeLimitExceeded}
+	tests := []struct {
+		name        string
+		res         store.InteractionResult
+		wantStatus  string
+		wantMessage string
+	}{
+		{
+			name:       "internal error",
+			res:        store.InteractionResult{Execution: store.ExecutionResult{Status: store.StatusInternalError, Error: "failed to start sandbox"}, InteractorError: "interactor: killed"},
+			wantStatus: store.StatusInternalError,
+		},
+		{
+			name:        "interactor crashed",
+			res:         store.InteractionResult{Execution: completed, InteractorError: "interactor: killed by signal 11"},
+			wantStatus:  store.StatusCheckerFailure,
+			wantMessage: "interactor failed",
+		},
+		{
+			name:        "interactor crashed, program timed out",
+			res:         store.InteractionResult{Execution: timeLimit, InteractorError: "interactor: exceeded the time limit of 10000ms"},
+			wantStatus:  store.StatusCheckerFailure,
+			wantMessage: "interactor failed",
+		},
+		{
+			name:        "interactor fail verdict",
+			res:         store.InteractionResult{Execution: timeLimit, InteractorExitCode: 3, InteractorMessage: "bad test"},
+			wantStatus:  store.StatusCheckerFailure,
+			wantMessage: "bad test",
+		},
+		{
+			name:       "accepted",
+			res:        store.InteractionResult{Execution: completed, InteractorExitCode: 0},
+			wantStatus: store.StatusAccepted,
+		},
+		{
+			name:        "wrong answer",
+			res:         store.InteractionResult{Execution: completed, InteractorExitCode: 1, InteractorMessage: "expected 5, found 4"},
+			wantStatus:  store.StatusWrongAnswer,
+			wantMessage: "expected 5, found 4",
+		},
+		{
+			name:        "broken pipe after wrong answer",
+			res:         store.InteractionResult{Execution: brokenPipe, InteractorExitCode: 1, InteractorMessage: "too many queries"},
+			wantStatus:  store.StatusWrongAnswer,
+			wantMessage: "too many queries",
+		},
+		{
+			name:       "broken pipe after accepted",
+			res:        store.InteractionResult{Execution: brokenPipe, InteractorExitCode: 0},
+			wantStatus: store.StatusRuntimeError,
+		},
+		{
+			name:        "crash after wrong answer",
+			res:         store.InteractionResult{Execution: segfault, InteractorExitCode: 1, InteractorMessage: "unexpected EOF"},
+			wantStatus:  store.StatusRuntimeError,
+			wantMessage: "unexpected EOF",
+		},
+		{
+			name:       "time limit before accepted",
+			res:        store.InteractionResult{Execution: timeLimit, InteractorExitCode: 0},
+			wantStatus: store.StatusTimeLimitExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InteractionVerdict(tt.res)
+			if got.Status != tt.wantStatus || got.Message != tt.wantMessage {
+				t.Errorf("InteractionVerdict = %s %q, want %s %q", got.Status, got.Message, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestCheckerVerdict(t *testing.T) {
+	tests := []struct {
+		name       string
+		exitCode   int
+		message    string
+		wantStatus string
+		wantScore  float64
+	}{
+		{"ok", 0, "ok 3 numbers\n", store.StatusAccepted, 1},
+		{"wrong answer", 1, "wrong answer 1st numbers differ", store.StatusWrongAnswer, 0},
+		{"presentation error", 2, "wrong output format", store.StatusPresentationError, 0},
+		{"fail", 3, "answer file is broken", store.StatusCheckerFailure, 0},
+		{"dirt", 4, "extra tokens", store.StatusPresentationError, 0},
+		{"unexpected EOF", 8, "unexpected end of file", store.StatusPresentationError, 0},
+		{"points", 7, "points 0.25 half of the queries", store.StatusPartial, 0.25},
+		{"points full", 7, "points 1", store.StatusAccepted, 1},
+		{"points above full", 7, "points 1.5", store.StatusAccepted, 1},
+		{"points negative", 7, "points -2", store.StatusPartial, 0},
+		{"points NaN", 7, "points NaN", store.StatusPartial, 0},
+		{"points missing", 7, "points", store.StatusCheckerFailure, 0},
+		{"points malformed", 7, "points half", store.StatusCheckerFailure, 0},
+		{"partial zero", 0x10, "", store.StatusPartial, 0},
+		{"partial", 0x10 + 40, "40 percent", store.StatusPartial, 0.4},
+		{"partial full", 0x10 + 100, "", store.StatusAccepted, 1},
+		{"partial above full", 0xff, "", store.StatusAccepted, 1},
+		{"unknown code", 5, "", store.StatusCheckerFailure, 0},
+		{"negative code", -1, "", store.StatusCheckerFailure, 0},
+		{"code above a byte", 0x100, "", store.StatusCheckerFailure, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckerVerdict(tt.exitCode, tt.message)
+			if got.Status != tt.wantStatus || math.Abs(got.Score-tt.wantScore) > 1e-9 {
+				t.Errorf("CheckerVerdict(%d, %q) = %s with score %v, want %s with score %v",
+					tt.exitCode, tt.message, got.Status, got.Score, tt.wantStatus, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	tests := []struct {
+		message string
+		want    float64
+		wantErr bool
+	}{
+		{message: "points 0.5", want: 0.5},
+		{message: "points 1e-1 close enough", want: 0.1},
+		{message: "points   3\tpoints", want: 3},
+		{message: "points -0.5", want: 0},
+		{message: "points", wantErr: true},
+		{message: "points five", wantErr: true},
+		{message: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePoints(tt.message)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePoints(%q) = %v, want an error", tt.message, got)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("parsePoints(%q) = %v, %v, want %v", tt.message, got, err, tt.want)
+		}
+	}
+}
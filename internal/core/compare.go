@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"judge-service/internal/store"
+)
+
+// Comparison modes a problem can select in its checker spec.
+const (
+	ModeLines           = "lines"            // CompareOutputs; the default
+	ModeExact           = "exact"            // Byte-for-byte
+	ModeTokens          = "tokens"           // Whitespace-separated tokens, ignoring layout
+	ModeFloat           = "float"            // Tokens, with numbers compared within an epsilon
+	ModeCaseInsensitive = "case-insensitive" // As lines, ignoring letter case
+	ModeUnorderedLines  = "unordered-lines"  // As lines, in any order
+)
+
+// defaultEpsilon is used by ModeFloat when the problem sets neither epsilon.
+const defaultEpsilon = 1e-6
+
+// Comparator reports whether an output matches the expected output.
+type Comparator func(actual, expected string) bool
+
+// NewComparator returns the comparison the spec selects.
+func NewComparator(spec store.CheckerSpec) (Comparator, error) {
+	switch spec.Mode {
+	case "", ModeLines:
+		return CompareOutputs, nil
+	case ModeExact:
+		return func(actual, expected string) bool { return actual == expected }, nil
+	case ModeTokens:
+		return CompareTokens, nil
+	case ModeFloat:
+		if spec.AbsEpsilon < 0 || spec.RelEpsilon < 0 {
+			return nil, fmt.Errorf("epsilons must not be negative")
+		}
+		absEps, relEps := spec.AbsEpsilon, spec.RelEpsilon
+		if absEps == 0 && relEps == 0 {
+			absEps, relEps = defaultEpsilon, defaultEpsilon
+		}
+		return func(actual, expected string) bool {
+			return CompareFloats(actual, expected, absEps, relEps)
+		}, nil
+	case ModeCaseInsensitive:
+		return func(actual, expected string) bool {
+			return strings.EqualFold(normalizeLines(actual), normalizeLines(expected))
+		}, nil
+	case ModeUnorderedLines:
+		return CompareUnorderedLines, nil
+	default:
+		return nil, fmt.Errorf("unknown comparison mode %q", spec.Mode)
+	}
+}
+
+// CheckOutput judges an output by compare. With strictLayout, an output
+// that compare rejects but whose tokens match the expected ones is a
+// Presentation Error rather than a Wrong Answer.
+func CheckOutput(compare Comparator, strictLayout bool, actualOutput, expectedOutput string) CheckResult {
+	if compare(actualOutput, expectedOutput) {
+		return CheckResult{Status: store.StatusAccepted, Score: 1}
+	}
+	if strictLayout && CompareTokens(actualOutput, expectedOutput) {
+		return CheckResult{Status: store.StatusPresentationError, Message: "output differs from the expected output only in whitespace"}
+	}
+	return CheckResult{Status: store.StatusWrongAnswer}
+}
+
+// CompareTokens compares the whitespace-separated tokens of both outputs,
+// ignoring how they are laid out.
+func CompareTokens(actualOutput, expectedOutput string) bool {
+	actual, expected := strings.Fields(actualOutput), strings.Fields(expectedOutput)
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareFloats compares outputs token by token like CompareTokens, except
+// that where the expected token is a number the actual one may differ from
+// it by up to absEps, or by up to relEps relative to the expected value.
+func CompareFloats(actualOutput, expectedOutput string, absEps, relEps float64) bool {
+	actual, expected := strings.Fields(actualOutput), strings.Fields(expectedOutput)
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		if actual[i] == expected[i] {
+			continue
+		}
+		want, err := strconv.ParseFloat(expected[i], 64)
+		if err != nil {
+			return false
+		}
+		got, err := strconv.ParseFloat(actual[i], 64)
+		if err != nil || math.IsNaN(got) || math.IsInf(got, 0) {
+			return false
+		}
+		diff := math.Abs(got - want)
+		if diff > absEps && diff > relEps*math.Abs(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareUnorderedLines compares the lines of both outputs as multisets,
+// normalized as in CompareOutputs.
+func CompareUnorderedLines(actualOutput, expectedOutput string) bool {
+	actual := strings.Split(normalizeLines(actualOutput), "\n")
+	expected := strings.Split(normalizeLines(expectedOutput), "\n")
+	if len(actual) != len(expected) {
+		return false
+	}
+	sort.Strings(actual)
+	sort.Strings(expected)
+	for i := range actual {
+		if actual[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
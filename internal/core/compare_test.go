@@ -0,0 +1,114 @@
+package core
+
+import (
+	"testing"
+
+	"judge-service/internal/store"
+)
+
+func TestNewComparator(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     store.CheckerSpec
+		actual   string
+		expected string
+		want     bool
+	}{
+		{"lines equal", store.CheckerSpec{}, "1 2\n3\n", "1 2\n3\n", true},
+		{"lines trailing whitespace", store.CheckerSpec{Mode: ModeLines}, "1 2  \n3\t\n\n\n", "1 2\n3", true},
+		{"lines CRLF", store.CheckerSpec{Mode: ModeLines}, "1 2\r\n3\r\n", "1 2\n3\n", true},
+		{"lines inner whitespace", store.CheckerSpec{Mode: ModeLines}, "1  2\n3\n", "1 2\n3\n", false},
+		{"lines joined", store.CheckerSpec{Mode: ModeLines}, "1 2 3\n", "1 2\n3\n", false},
+		{"lines leading blank line", store.CheckerSpec{Mode: ModeLines}, "\n1\n", "1\n", false},
+		{"lines empty expected", store.CheckerSpec{}, "\n\n", "", true},
+		{"lines empty expected, output", store.CheckerSpec{}, "0\n", "", false},
+
+		{"exact equal", store.CheckerSpec{Mode: ModeExact}, "1\n", "1\n", true},
+		{"exact trailing newline", store.CheckerSpec{Mode: ModeExact}, "1", "1\n", false},
+
+		{"tokens layout", store.CheckerSpec{Mode: ModeTokens}, " 1\n2   3\r\n\n", "1 2 3", true},
+		{"tokens differ", store.CheckerSpec{Mode: ModeTokens}, "1 2 4", "1 2 3", false},
+		{"tokens missing", store.CheckerSpec{Mode: ModeTokens}, "1 2", "1 2 3", false},
+		{"tokens empty expected", store.CheckerSpec{Mode: ModeTokens}, " \n", "", true},
+
+		{"float default epsilon", store.CheckerSpec{Mode: ModeFloat}, "0.3333333", "0.333333333", true},
+		{"float default epsilon exceeded", store.CheckerSpec{Mode: ModeFloat}, "0.3333", "0.333333333", false},
+		{"float absolute", store.CheckerSpec{Mode: ModeFloat, AbsEpsilon: 0.01}, "1.005 2", "1 2", true},
+		{"float absolute exceeded", store.CheckerSpec{Mode: ModeFloat, AbsEpsilon: 0.01}, "1.02", "1", false},
+		{"float relative", store.CheckerSpec{Mode: ModeFloat, RelEpsilon: 1e-3}, "1000.5", "1000", true},
+		{"float relative exceeded", store.CheckerSpec{Mode: ModeFloat, RelEpsilon: 1e-3}, "1.01", "1", false},
+		{"float either epsilon", store.CheckerSpec{Mode: ModeFloat, AbsEpsilon: 0.1, RelEpsilon: 1e-3}, "0.05 1000.5", "0 1000", true},
+		{"float exponent", store.CheckerSpec{Mode: ModeFloat}, "1e3", "1000.0", true},
+		{"float words", store.CheckerSpec{Mode: ModeFloat}, "YES 1.0000001", "YES 1", true},
+		{"float word differs", store.CheckerSpec{Mode: ModeFloat}, "NO 1", "YES 1", false},
+		{"float NaN", store.CheckerSpec{Mode: ModeFloat, AbsEpsilon: 1e9}, "NaN", "1", false},
+		{"float Inf", store.CheckerSpec{Mode: ModeFloat, AbsEpsilon: 1e9}, "+Inf", "1", false},
+		{"float NaN expected", store.CheckerSpec{Mode: ModeFloat}, "NaN", "NaN", true},
+		{"float not a number", store.CheckerSpec{Mode: ModeFloat}, "one", "1", false},
+		{"float empty expected", store.CheckerSpec{Mode: ModeFloat}, "\n", "", true},
+
+		{"case-insensitive", store.CheckerSpec{Mode: ModeCaseInsensitive}, "Yes  \r\nNO\n", "YES\nno", true},
+		{"case-insensitive differs", store.CheckerSpec{Mode: ModeCaseInsensitive}, "Yes\n", "YES\nNO", false},
+
+		{"unordered lines", store.CheckerSpec{Mode: ModeUnorderedLines}, "b\na \nc\n", "a\nb\nc", true},
+		{"unordered lines count", store.CheckerSpec{Mode: ModeUnorderedLines}, "a\na\nb\n", "a\nb\nb\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compare, err := NewComparator(tt.spec)
+			if err != nil {
+				t.Fatalf("NewComparator(%+v): %v", tt.spec, err)
+			}
+			if got := compare(tt.actual, tt.expected); got != tt.want {
+				t.Errorf("compare(%q, %q) = %v, want %v", tt.actual, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewComparatorInvalid(t *testing.T) {
+	for _, spec := range []store.CheckerSpec{
+		{Mode: "regex"},
+		{Mode: ModeFloat, AbsEpsilon: -1e-6},
+		{Mode: ModeFloat, RelEpsilon: -1e-6},
+	} {
+		if _, err := NewComparator(spec); err == nil {
+			t.Errorf("NewComparator(%+v) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		strictLayout bool
+		actual       string
+		expected     string
+		wantStatus   string
+		wantScore    float64
+	}{
+		{"accepted", false, "1 2\n", "1 2\n", store.StatusAccepted, 1},
+		{"accepted, strict", true, "1 2  \r\n", "1 2\n", store.StatusAccepted, 1},
+		{"wrong answer", false, "1 3\n", "1 2\n", store.StatusWrongAnswer, 0},
+		{"wrong answer, strict", true, "1 3\n", "1 2\n", store.StatusWrongAnswer, 0},
+		{"layout, lenient", false, "1\n2\n", "1 2\n", store.StatusWrongAnswer, 0},
+		{"layout, strict", true, "1\n2\n", "1 2\n", store.StatusPresentationError, 0},
+		{"inner spaces, strict", true, "1   2\n", "1 2\n", store.StatusPresentationError, 0},
+	}
+	compare, err := NewComparator(store.CheckerSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CheckOutput(compare, tt.strictLayout, tt.actual, tt.expected)
+			if got.Status != tt.wantStatus || got.Score != tt.wantScore {
+				t.Errorf("CheckOutput(%q, %q) = %s with score %v, want %s with score %v",
+					tt.actual, tt.expected, got.Status, got.Score, tt.wantStatus, tt.wantScore)
+			}
+			if got.Status == store.StatusPresentationError && got.Message == "" {
+				t.Errorf("Presentation Error without a message")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"math"
+
+	"judge-service/internal/store"
+)
+
+// SubtaskScorer scores a submission to a problem with subtasks as the
+// scores of its tests come in. Tests are numbered from 0 here, in the
+// order of the problem's test cases.
+type SubtaskScorer struct {
+	subtasks []store.Subtask
+	tests    [][]int   // 0-based tests of each subtask
+	deps     [][]int   // 0-based dependencies of each subtask
+	scores   []float64 // Score of each test, NaN until recorded
+}
+
+// NewSubtaskScorer validates subtasks against a problem with numTests test
+// cases and returns a scorer for them.
+func NewSubtaskScorer(subtasks []store.Subtask, numTests int) (*SubtaskScorer, error) {
+	s := &SubtaskScorer{
+		subtasks: subtasks,
+		tests:    make([][]int, len(subtasks)),
+		deps:     make([][]int, len(subtasks)),
+		scores:   make([]float64, numTests),
+	}
+	for i := range s.scores {
+		s.scores[i] = math.NaN()
+	}
+
+	for i, subtask := range subtasks {
+		switch subtask.Scoring {
+		case "", store.ScoringAllOrNothing, store.ScoringMin, store.ScoringSum:
+		default:
+			return nil, fmt.Errorf("subtask %d: unknown scoring policy %q", i+1, subtask.Scoring)
+		}
+		if subtask.Points < 0 {
+			return nil, fmt.Errorf("subtask %d: points must not be negative", i+1)
+		}
+		if len(subtask.Tests) == 0 {
+			return nil, fmt.Errorf("subtask %d has no tests", i+1)
+		}
+		// A test may be in several subtasks, but only once in each, or it
+		// would count twice towards a sum.
+		seen := make(map[int]bool)
+		for _, test := range subtask.Tests {
+			if test < 1 || test > numTests {
+				return nil, fmt.Errorf("subtask %d: no test %d", i+1, test)
+			}
+			if seen[test] {
+				return nil, fmt.Errorf("subtask %d: test %d listed twice", i+1, test)
+			}
+			seen[test] = true
+			s.tests[i] = append(s.tests[i], test-1)
+		}
+		// Dependencies on earlier subtasks only rule out cycles.
+		for _, dep := range subtask.DependsOn {
+			if dep < 1 || dep > i {
+				return nil, fmt.Errorf("subtask %d: can only depend on earlier subtasks, not %d", i+1, dep)
+			}
+			s.deps[i] = append(s.deps[i], dep-1)
+		}
+	}
+	return s, nil
+}
+
+// Record sets the score of a test, a fraction between 0 and 1.
+func (s *SubtaskScorer) Record(test int, score float64) {
+	s.scores[test] = score
+}
+
+// Doomed reports whether running a test can no longer change the score:
+// every subtask containing it has lost its points already. Tests outside
+// all subtasks are never doomed.
+func (s *SubtaskScorer) Doomed(test int) bool {
+	inSubtask := false
+	for i, tests := range s.tests {
+		for _, t := range tests {
+			if t == test {
+				inSubtask = true
+				if !s.lost(i) {
+					return false
+				}
+				break
+			}
+		}
+	}
+	return inSubtask
+}
+
+// Results returns the total score and the score of every subtask. Tests
+// not recorded count as scoring 0.
+func (s *SubtaskScorer) Results() (total float64, results []store.SubtaskResult) {
+	results = make([]store.SubtaskResult, len(s.subtasks))
+	for i, subtask := range s.subtasks {
+		score := 0.0
+		if !s.dependencyMissed(i) {
+			score = subtask.Points * s.fraction(i)
+		}
+		results[i] = store.SubtaskResult{
+			Index:    i + 1,
+			Name:     subtask.Name,
+			Score:    score,
+			MaxScore: subtask.Points,
+		}
+		total += score
+	}
+	return total, results
+}
+
+// MaxScore returns the points of all subtasks together.
+func (s *SubtaskScorer) MaxScore() float64 {
+	var total float64
+	for _, subtask := range s.subtasks {
+		total += subtask.Points
+	}
+	return total
+}
+
+// fraction is the share of its points subtask i earns by its own tests.
+func (s *SubtaskScorer) fraction(i int) float64 {
+	minScore, sum := 1.0, 0.0
+	for _, t := range s.tests[i] {
+		score := s.scores[t]
+		if math.IsNaN(score) {
+			score = 0
+		}
+		minScore = math.Min(minScore, score)
+		sum += score
+	}
+	switch s.subtasks[i].Scoring {
+	case store.ScoringMin:
+		return minScore
+	case store.ScoringSum:
+		return sum / float64(len(s.tests[i]))
+	default:
+		if minScore < 1 {
+			return 0
+		}
+		return 1
+	}
+}
+
+// lost reports whether subtask i can no longer earn any points.
+func (s *SubtaskScorer) lost(i int) bool {
+	if s.dependencyMissed(i) {
+		return true
+	}
+	switch s.subtasks[i].Scoring {
+	case store.ScoringSum:
+		return false
+	case store.ScoringMin:
+		return s.anyRecorded(i, func(score float64) bool { return score <= 0 })
+	default:
+		return s.anyRecorded(i, notFull)
+	}
+}
+
+// dependencyMissed reports whether a subtask that i depends on can no
+// longer earn full points.
+func (s *SubtaskScorer) dependencyMissed(i int) bool {
+	for _, dep := range s.deps[i] {
+		if s.dependencyMissed(dep) || s.anyRecorded(dep, notFull) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyRecorded reports whether a test of subtask i has a recorded score
+// matching cond.
+func (s *SubtaskScorer) anyRecorded(i int, cond func(score float64) bool) bool {
+	for _, t := range s.tests[i] {
+		if score := s.scores[t]; !math.IsNaN(score) && cond(score) {
+			return true
+		}
+	}
+	return false
+}
+
+func notFull(score float64) bool {
+	return score < 1
+}
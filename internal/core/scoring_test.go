@@ -0,0 +1,187 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"judge-service/internal/store"
+)
+
+func TestNewSubtaskScorerInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtasks []store.Subtask
+	}{
+		{"unknown scoring", []store.Subtask{{Points: 10, Tests: []int{1}, Scoring: "max"}}},
+		{"negative points", []store.Subtask{{Points: -1, Tests: []int{1}}}},
+		{"no tests", []store.Subtask{{Points: 10}}},
+		{"test 0", []store.Subtask{{Points: 10, Tests: []int{0, 1}}}},
+		{"test past the last", []store.Subtask{{Points: 10, Tests: []int{3, 4}}}},
+		{"test listed twice", []store.Subtask{{Points: 10, Tests: []int{1, 2, 1}}}},
+		{"depends on itself", []store.Subtask{{Points: 10, Tests: []int{1}, DependsOn: []int{1}}}},
+		{"depends on a later subtask", []store.Subtask{
+			{Points: 10, Tests: []int{1}, DependsOn: []int{2}},
+			{Points: 10, Tests: []int{2}},
+		}},
+		{"depends on subtask 0", []store.Subtask{
+			{Points: 10, Tests: []int{1}},
+			{Points: 10, Tests: []int{2}, DependsOn: []int{0}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSubtaskScorer(tt.subtasks, 3); err == nil {
+				t.Errorf("NewSubtaskScorer succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestNewSubtaskScorerSharedTests(t *testing.T) {
+	subtasks := []store.Subtask{
+		{Points: 40, Tests: []int{1, 2}},
+		{Points: 60, Tests: []int{2, 3}, DependsOn: []int{1}},
+	}
+	if _, err := NewSubtaskScorer(subtasks, 3); err != nil {
+		t.Errorf("NewSubtaskScorer with a test in two subtasks: %v", err)
+	}
+}
+
+func TestSubtaskScorerResults(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name       string
+		subtasks   []store.Subtask
+		scores     []float64 // Per test, NaN for not recorded
+		wantScores []float64 // Per subtask
+	}{
+		{
+			name: "all or nothing",
+			subtasks: []store.Subtask{
+				{Points: 30, Tests: []int{1, 2}},
+				{Points: 70, Tests: []int{3, 4}, Scoring: store.ScoringAllOrNothing},
+			},
+			scores:     []float64{1, 1, 1, 0.5},
+			wantScores: []float64{30, 0},
+		},
+		{
+			name:       "min",
+			subtasks:   []store.Subtask{{Points: 50, Tests: []int{1, 2, 3}, Scoring: store.ScoringMin}},
+			scores:     []float64{1, 0.4, 0.8},
+			wantScores: []float64{20},
+		},
+		{
+			name:       "sum",
+			subtasks:   []store.Subtask{{Points: 60, Tests: []int{1, 2, 3}, Scoring: store.ScoringSum}},
+			scores:     []float64{1, 0.5, 0},
+			wantScores: []float64{30},
+		},
+		{
+			name:       "unrecorded tests score 0",
+			subtasks:   []store.Subtask{{Points: 40, Tests: []int{1, 2}, Scoring: store.ScoringSum}},
+			scores:     []float64{1, nan},
+			wantScores: []float64{20},
+		},
+		{
+			name: "dependency missed",
+			subtasks: []store.Subtask{
+				{Points: 20, Tests: []int{1}, Scoring: store.ScoringSum},
+				{Points: 30, Tests: []int{2}, DependsOn: []int{1}},
+				{Points: 50, Tests: []int{3}, DependsOn: []int{2}},
+			},
+			scores:     []float64{0.5, 1, 1},
+			wantScores: []float64{10, 0, 0},
+		},
+		{
+			name: "dependency met",
+			subtasks: []store.Subtask{
+				{Points: 20, Tests: []int{1}},
+				{Points: 80, Tests: []int{1, 2}, Scoring: store.ScoringMin, DependsOn: []int{1}},
+			},
+			scores:     []float64{1, 0.25},
+			wantScores: []float64{20, 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSubtaskScorer(tt.subtasks, len(tt.scores))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for test, score := range tt.scores {
+				if !math.IsNaN(score) {
+					s.Record(test, score)
+				}
+			}
+			total, results := s.Results()
+			wantTotal := 0.0
+			for i, want := range tt.wantScores {
+				wantTotal += want
+				if math.Abs(results[i].Score-want) > 1e-9 {
+					t.Errorf("subtask %d scored %v, want %v", i+1, results[i].Score, want)
+				}
+				if results[i].Index != i+1 || results[i].MaxScore != tt.subtasks[i].Points {
+					t.Errorf("subtask %d reported as %+v", i+1, results[i])
+				}
+			}
+			if math.Abs(total-wantTotal) > 1e-9 {
+				t.Errorf("total %v, want %v", total, wantTotal)
+			}
+		})
+	}
+}
+
+func TestSubtaskScorerDoomed(t *testing.T) {
+	subtasks := []store.Subtask{
+		{Points: 20, Tests: []int{1, 2}},
+		{Points: 30, Tests: []int{3, 4}, Scoring: store.ScoringMin},
+		{Points: 30, Tests: []int{5, 6}, Scoring: store.ScoringSum},
+		{Points: 20, Tests: []int{2, 7}, DependsOn: []int{2}},
+	}
+	tests := []struct {
+		name   string
+		scores map[int]float64 // Recorded scores by 0-based test
+		doomed []int           // 0-based tests doomed after them
+	}{
+		{"nothing recorded", nil, nil},
+		{"all or nothing lost", map[int]float64{0: 0.5}, []int{0}},
+		{"min lost", map[int]float64{2: 0}, []int{2, 3, 6}},
+		{"min partly earned, dependency missed", map[int]float64{2: 0.5}, []int{6}},
+		{"sum never lost", map[int]float64{4: 0, 5: 0}, nil},
+		{"shared test lost in one subtask", map[int]float64{0: 0, 3: 1}, []int{0}},
+		{"shared test lost in all", map[int]float64{0: 0, 6: 0}, []int{0, 1, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSubtaskScorer(subtasks, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for test, score := range tt.scores {
+				s.Record(test, score)
+			}
+			doomed := make(map[int]bool)
+			for _, test := range tt.doomed {
+				doomed[test] = true
+			}
+			for test := 0; test < 8; test++ {
+				if got := s.Doomed(test); got != doomed[test] {
+					t.Errorf("Doomed(%d) = %v, want %v", test, got, doomed[test])
+				}
+			}
+		})
+	}
+}
+
+func TestSubtaskScorerMaxScore(t *testing.T) {
+	s, err := NewSubtaskScorer([]store.Subtask{
+		{Points: 12.5, Tests: []int{1}},
+		{Points: 87.5, Tests: []int{2}},
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.MaxScore(); got != 100 {
+		t.Errorf("MaxScore() = %v, want 100", got)
+	}
+}
@@ -0,0 +1,613 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"judge-service/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// In config.QueueModeBullMQ, jobs are taken from queues kept the way BullMQ
+// keeps them, so that the Node side can add jobs with queue.add and follow
+// them through QueueEvents. The keys of a queue start with
+// "<prefix>:<queue>:": "wait" and "active" are lists of job IDs,
+// "prioritized", "delayed", "completed" and "failed" sorted sets of them,
+// and "<id>" is a job's hash, with its data, options and progress. A worker
+// holds the lock "<id>:lock" on a job while handling it; jobs whose lock
+// lapses are put back by the stalled check. Progress is reported on the
+// "events" stream, and workers waiting for jobs are woken through "marker".
+
+// bullMoveToActiveScript promotes the queue's due delayed jobs, then moves
+// its next job to the active list, locks it and returns its ID and hash.
+// It returns nil when the queue is empty, paused or at its concurrency.
+//
+// KEYS: wait, active, prioritized, events, delayed, paused, meta, pc, marker
+// ARGV: key prefix, now in ms, lock token, lock duration in ms, worker name,
+// highest score of a due delayed job
+var bullMoveToActiveScript = redis.NewScript(`
+local rcall = redis.call
+local maxEvents = tonumber(rcall("HGET", KEYS[7], "opts.maxLenEvents") or 10000)
+local paused = rcall("HEXISTS", KEYS[7], "paused") == 1
+
+local due = rcall("ZRANGEBYSCORE", KEYS[5], 0, ARGV[6], "LIMIT", 0, 1000)
+for _, jobId in ipairs(due) do
+	rcall("ZREM", KEYS[5], jobId)
+	local priority = tonumber(rcall("HGET", ARGV[1] .. jobId, "priority") or 0)
+	if priority > 0 then
+		local counter = rcall("INCR", KEYS[8]) % 0x100000000
+		rcall("ZADD", KEYS[3], priority * 0x100000000 + counter, jobId)
+	elseif paused then
+		rcall("LPUSH", KEYS[6], jobId)
+	else
+		rcall("LPUSH", KEYS[1], jobId)
+	end
+	rcall("HSET", ARGV[1] .. jobId, "delay", 0)
+	rcall("XADD", KEYS[4], "MAXLEN", "~", maxEvents, "*", "event", "waiting", "jobId", jobId, "prev", "delayed")
+end
+
+if paused then
+	return false
+end
+local concurrency = tonumber(rcall("HGET", KEYS[7], "concurrency") or 0)
+if concurrency > 0 and rcall("LLEN", KEYS[2]) >= concurrency then
+	return false
+end
+
+local jobId = rcall("RPOPLPUSH", KEYS[1], KEYS[2])
+if not jobId then
+	local popped = rcall("ZPOPMIN", KEYS[3])
+	if #popped == 0 then
+		return false
+	end
+	jobId = popped[1]
+	rcall("LPUSH", KEYS[2], jobId)
+end
+
+local jobKey = ARGV[1] .. jobId
+rcall("SET", jobKey .. ":lock", ARGV[3], "PX", ARGV[4])
+rcall("HSET", jobKey, "processedOn", ARGV[2], "pb", ARGV[5])
+rcall("HINCRBY", jobKey, "ats", 1)
+rcall("XADD", KEYS[4], "MAXLEN", "~", maxEvents, "*", "event", "active", "jobId", jobId, "prev", "waiting")
+if rcall("LLEN", KEYS[1]) > 0 or rcall("ZCARD", KEYS[3]) > 0 then
+	rcall("ZADD", KEYS[9], 0, "0")
+end
+return {jobId, rcall("HGETALL", jobKey)}
+`)
+
+// bullExtendLockScript renews the lock on a job if it is still held with
+// the token, and returns 1 if so.
+//
+// KEYS: lock, stalled
+// ARGV: token, lock duration in ms, job ID
+var bullExtendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	redis.call("SREM", KEYS[2], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// bullMoveToFinishedScript moves a locked active job to the completed or
+// failed set with its return value or failure reason, keeping only as many
+// finished jobs as the job's options ask for. It returns -1 if the job is
+// gone, -2 if its lock is not held with the token and -3 if it is not
+// active.
+//
+// KEYS: job, active, stalled, completed or failed, events, meta
+// ARGV: job ID, token, now in ms, "returnvalue" or "failedReason", its
+// value, "completed" or "failed", finished jobs to keep (-1 for all), age
+// in ms beyond which finished jobs are removed (0 for none), key prefix
+var bullMoveToFinishedScript = redis.NewScript(`
+local rcall = redis.call
+if rcall("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if rcall("GET", KEYS[1] .. ":lock") ~= ARGV[2] then
+	return -2
+end
+rcall("DEL", KEYS[1] .. ":lock")
+rcall("SREM", KEYS[3], ARGV[1])
+if rcall("LREM", KEYS[2], -1, ARGV[1]) == 0 then
+	return -3
+end
+
+local maxEvents = tonumber(rcall("HGET", KEYS[6], "opts.maxLenEvents") or 10000)
+local attemptsMade = rcall("HINCRBY", KEYS[1], "atm", 1)
+rcall("XADD", KEYS[5], "MAXLEN", "~", maxEvents, "*", "event", ARGV[6], "jobId", ARGV[1], ARGV[4], ARGV[5], "prev", "active", "attemptsMade", attemptsMade)
+
+local keep = tonumber(ARGV[7])
+if keep == 0 then
+	rcall("DEL", KEYS[1], KEYS[1] .. ":logs")
+	return 0
+end
+rcall("HSET", KEYS[1], ARGV[4], ARGV[5], "finishedOn", ARGV[3])
+rcall("ZADD", KEYS[4], ARGV[3], ARGV[1])
+
+local function remove(jobIds)
+	for _, jobId in ipairs(jobIds) do
+		rcall("DEL", ARGV[9] .. jobId, ARGV[9] .. jobId .. ":logs")
+		rcall("ZREM", KEYS[4], jobId)
+	end
+end
+local maxAge = tonumber(ARGV[8])
+if maxAge > 0 then
+	remove(rcall("ZRANGEBYSCORE", KEYS[4], 0, tonumber(ARGV[3]) - maxAge))
+end
+if keep > 0 then
+	remove(rcall("ZRANGE", KEYS[4], 0, -(keep + 1)))
+end
+return 0
+`)
+
+// bullRetryScript puts a locked active job that failed back in the queue,
+// delayed if the delay is positive. It returns the codes of
+// bullMoveToFinishedScript.
+//
+// KEYS: job, active, stalled, wait, paused, delayed, events, meta, marker
+// ARGV: job ID, token, failure reason, delay in ms, its delayed score, the
+// time it is due in ms
+var bullRetryScript = redis.NewScript(`
+local rcall = redis.call
+if rcall("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if rcall("GET", KEYS[1] .. ":lock") ~= ARGV[2] then
+	return -2
+end
+rcall("DEL", KEYS[1] .. ":lock")
+rcall("SREM", KEYS[3], ARGV[1])
+if rcall("LREM", KEYS[2], -1, ARGV[1]) == 0 then
+	return -3
+end
+
+local maxEvents = tonumber(rcall("HGET", KEYS[8], "opts.maxLenEvents") or 10000)
+rcall("HINCRBY", KEYS[1], "atm", 1)
+rcall("HSET", KEYS[1], "failedReason", ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	rcall("HSET", KEYS[1], "delay", ARGV[4])
+	rcall("ZADD", KEYS[6], ARGV[5], ARGV[1])
+	rcall("ZADD", KEYS[9], ARGV[6], "1")
+	rcall("XADD", KEYS[7], "MAXLEN", "~", maxEvents, "*", "event", "delayed", "jobId", ARGV[1], "delay", ARGV[6])
+elseif rcall("HEXISTS", KEYS[8], "paused") == 1 then
+	rcall("LPUSH", KEYS[5], ARGV[1])
+	rcall("XADD", KEYS[7], "MAXLEN", "~", maxEvents, "*", "event", "waiting", "jobId", ARGV[1], "prev", "failed")
+else
+	rcall("LPUSH", KEYS[4], ARGV[1])
+	rcall("ZADD", KEYS[9], 0, "0")
+	rcall("XADD", KEYS[7], "MAXLEN", "~", maxEvents, "*", "event", "waiting", "jobId", ARGV[1], "prev", "failed")
+end
+return 0
+`)
+
+// bullStalledScript puts the active jobs found unlocked on the previous
+// check back in the queue, failing those that stalled too often, and marks
+// all active jobs for the next check. Renewing a lock unmarks its job. It
+// checks at most once per lock duration, whichever worker runs it.
+//
+// KEYS: stalled, wait, active, failed, stalled-check, meta, paused, marker,
+// events
+// ARGV: max stalled count, key prefix, now in ms, lock duration in ms
+var bullStalledScript = redis.NewScript(`
+local rcall = redis.call
+if rcall("EXISTS", KEYS[5]) == 1 then
+	return 0
+end
+rcall("SET", KEYS[5], ARGV[3], "PX", ARGV[4])
+
+local maxEvents = tonumber(rcall("HGET", KEYS[6], "opts.maxLenEvents") or 10000)
+local paused = rcall("HEXISTS", KEYS[6], "paused") == 1
+local moved = 0
+for _, jobId in ipairs(rcall("SMEMBERS", KEYS[1])) do
+	local jobKey = ARGV[2] .. jobId
+	if rcall("EXISTS", jobKey .. ":lock") == 0 and rcall("LREM", KEYS[3], 1, jobId) > 0 then
+		moved = moved + 1
+		if rcall("HINCRBY", jobKey, "stc", 1) > tonumber(ARGV[1]) then
+			local reason = "job stalled more than allowable limit"
+			rcall("ZADD", KEYS[4], ARGV[3], jobId)
+			rcall("HSET", jobKey, "failedReason", reason, "finishedOn", ARGV[3])
+			rcall("XADD", KEYS[9], "MAXLEN", "~", maxEvents, "*", "event", "failed", "jobId", jobId, "failedReason", reason, "prev", "active")
+		else
+			if paused then
+				rcall("RPUSH", KEYS[7], jobId)
+			else
+				rcall("RPUSH", KEYS[2], jobId)
+				rcall("ZADD", KEYS[8], 0, "0")
+			end
+			rcall("XADD", KEYS[9], "MAXLEN", "~", maxEvents, "*", "event", "waiting", "jobId", jobId, "prev", "active")
+			rcall("XADD", KEYS[9], "MAXLEN", "~", maxEvents, "*", "event", "stalled", "jobId", jobId)
+		end
+	end
+end
+
+rcall("DEL", KEYS[1])
+local active = rcall("LRANGE", KEYS[3], 0, -1)
+for _, jobId in ipairs(active) do
+	rcall("SADD", KEYS[1], jobId)
+end
+return moved
+`)
+
+// bullJob is a BullMQ job a worker has taken.
+type bullJob struct {
+	queue  string
+	id     string
+	token  string            // Of the lock on the job
+	fields map[string]string // The job's hash
+}
+
+// bullJobOptions are the options of a BullMQ job the consumer heeds.
+type bullJobOptions struct {
+	Attempts         int             `json:"attempts"`
+	Backoff          json.RawMessage `json:"backoff"`
+	RemoveOnComplete json.RawMessage `json:"removeOnComplete"`
+	RemoveOnFail     json.RawMessage `json:"removeOnFail"`
+}
+
+// workBullMQ takes and handles BullMQ jobs one at a time until ctx is done.
+func (c *Consumer) workBullMQ(ctx context.Context, worker int, handler Handler) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Consumer context done. Stopping worker %d.", worker)
+			return
+		default:
+			job, err := c.takeBullMQ(ctx, worker)
+			if err != nil {
+				if err == context.Canceled {
+					return // Normal exit condition
+				}
+				log.Printf("Error receiving from Redis: %v", err)
+				time.Sleep(1 * time.Second) // Prevent busy-looping on other errors
+				continue
+			}
+
+			jobData := job.fields["data"]
+			log.Printf("Worker %d received job %s from queue %s: %s", worker, job.id, job.queue, jobData)
+
+			var payload store.SubmissionPayload
+			if err := json.Unmarshal([]byte(jobData), &payload); err != nil {
+				log.Printf("Error unmarshalling job data %s: %v", jobData, err)
+				c.settleBullMQ(job, nil, fmt.Errorf("invalid job data: %w", err), false)
+				continue
+			}
+
+			// A submission ID must be present
+			if payload.SubmissionID == "" {
+				log.Println("Received job with empty submission ID.")
+				c.settleBullMQ(job, nil, fmt.Errorf("job data has no submission ID"), false)
+				continue
+			}
+
+			stop := c.keepLocked(job)
+			result, err := handler(ctx, worker, &payload)
+			stop()
+			if ctx.Err() != nil {
+				// The job was cut short by shutdown. It stays active until
+				// its lock lapses and the stalled check puts it back.
+				log.Printf("Left job %s of queue %s active for the stalled check", job.id, job.queue)
+				continue
+			}
+			if err != nil {
+				log.Printf("Error handling job for submission %s: %v", payload.SubmissionID, err)
+			}
+			c.settleBullMQ(job, result, err, true)
+			if err == nil {
+				log.Printf("Finished processing submission ID: %s", payload.SubmissionID)
+			}
+		}
+	}
+}
+
+// takeBullMQ moves the next job of the queues, in the order the policy
+// picks, to its active list and locks it for the worker, blocking until
+// there is one.
+func (c *Consumer) takeBullMQ(ctx context.Context, worker int) (*bullJob, error) {
+	markers := make([]string, len(c.Queues))
+	for i, queue := range c.Queues {
+		markers[i] = c.bullKey(queue.Name, "marker")
+	}
+
+	for {
+		token, err := lockToken(c.ID, worker)
+		if err != nil {
+			return nil, err
+		}
+		for _, queue := range c.order() {
+			job, err := c.moveToActive(ctx, queue, token)
+			if err != nil || job != nil {
+				return job, err
+			}
+		}
+
+		// All queues are empty. A marker is added when jobs come, or with
+		// the time the next delayed job is due.
+		marker, err := c.RDB.BZPopMin(ctx, idlePoll, markers...).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		wait := time.Until(time.UnixMilli(int64(marker.Score)))
+		if marker.Score > 0 && wait > 0 {
+			// Leave it for whoever is free when the job is due.
+			if err := c.RDB.ZAdd(ctx, marker.Key, marker.Z).Err(); err != nil {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(min(wait, idlePoll)):
+			}
+		}
+	}
+}
+
+// moveToActive takes the next job of a queue with the lock token, or
+// returns nil if there is none to take.
+func (c *Consumer) moveToActive(ctx context.Context, queue, token string) (*bullJob, error) {
+	now := time.Now().UnixMilli()
+	keys := []string{
+		c.bullKey(queue, "wait"),
+		c.bullKey(queue, "active"),
+		c.bullKey(queue, "prioritized"),
+		c.bullKey(queue, "events"),
+		c.bullKey(queue, "delayed"),
+		c.bullKey(queue, "paused"),
+		c.bullKey(queue, "meta"),
+		c.bullKey(queue, "pc"),
+		c.bullKey(queue, "marker"),
+	}
+	taken, err := bullMoveToActiveScript.Run(ctx, c.RDB, keys,
+		c.bullKey(queue, ""), now, token, c.LockDuration.Milliseconds(), c.ID, delayedScore(now+1)-1).Slice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(taken) != 2 {
+		return nil, fmt.Errorf("unexpected reply %v to taking a job", taken)
+	}
+	id, _ := taken[0].(string)
+	hash, _ := taken[1].([]interface{})
+	job := &bullJob{queue: queue, id: id, token: token, fields: make(map[string]string)}
+	for i := 0; i+1 < len(hash); i += 2 {
+		field, _ := hash[i].(string)
+		value, _ := hash[i+1].(string)
+		job.fields[field] = value
+	}
+	return job, nil
+}
+
+// keepLocked renews the lock on a job every half lock duration until the
+// returned function is called.
+func (c *Consumer) keepLocked(job *bullJob) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.LockDuration / 2)
+		defer ticker.Stop()
+		keys := []string{c.bullKey(job.queue, job.id+":lock"), c.bullKey(job.queue, "stalled")}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renewed, err := bullExtendLockScript.Run(ctx, c.RDB, keys, job.token, c.LockDuration.Milliseconds(), job.id).Int()
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Warning: failed to renew lock on job %s of queue %s: %v", job.id, job.queue, err)
+					}
+					continue
+				}
+				if renewed == 0 {
+					log.Printf("Warning: lost lock on job %s of queue %s, it may be handled again", job.id, job.queue)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// settleBullMQ moves a handled job to completed with the handler's result,
+// or if handling failed, back to the queue while it has attempts left and
+// retry allows, and to failed otherwise. It does not use the consumer's
+// context, so that a job finished while shutting down is not handled again.
+func (c *Consumer) settleBullMQ(job *bullJob, result any, jobErr error, retry bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var opts bullJobOptions
+	if raw := job.fields["opts"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+			log.Printf("Warning: invalid options %s of job %s of queue %s: %v", raw, job.id, job.queue, err)
+		}
+	}
+	now := time.Now().UnixMilli()
+	attemptsMade, _ := strconv.Atoi(job.fields["atm"])
+	attemptsMade++
+
+	var code int
+	var err error
+	if jobErr != nil && retry && attemptsMade < opts.Attempts {
+		delay := bullBackoff(opts.Backoff, attemptsMade)
+		keys := []string{
+			c.bullKey(job.queue, job.id),
+			c.bullKey(job.queue, "active"),
+			c.bullKey(job.queue, "stalled"),
+			c.bullKey(job.queue, "wait"),
+			c.bullKey(job.queue, "paused"),
+			c.bullKey(job.queue, "delayed"),
+			c.bullKey(job.queue, "events"),
+			c.bullKey(job.queue, "meta"),
+			c.bullKey(job.queue, "marker"),
+		}
+		code, err = bullRetryScript.Run(ctx, c.RDB, keys,
+			job.id, job.token, jobErr.Error(), delay, delayedScore(now+delay), now+delay).Int()
+		if err == nil && code == 0 {
+			log.Printf("Job %s of queue %s failed %d of %d times, retrying in %dms", job.id, job.queue, attemptsMade, opts.Attempts, delay)
+		}
+	} else {
+		target, property, value, remove := "completed", "returnvalue", "", opts.RemoveOnComplete
+		if jobErr != nil {
+			target, property, value, remove = "failed", "failedReason", jobErr.Error(), opts.RemoveOnFail
+		} else if encoded, err := json.Marshal(result); err != nil {
+			log.Printf("Warning: failed to encode result of job %s of queue %s: %v", job.id, job.queue, err)
+			value = "null"
+		} else {
+			value = string(encoded)
+		}
+		keep, maxAgeMs := bullKeepJobs(remove)
+		keys := []string{
+			c.bullKey(job.queue, job.id),
+			c.bullKey(job.queue, "active"),
+			c.bullKey(job.queue, "stalled"),
+			c.bullKey(job.queue, target),
+			c.bullKey(job.queue, "events"),
+			c.bullKey(job.queue, "meta"),
+		}
+		code, err = bullMoveToFinishedScript.Run(ctx, c.RDB, keys,
+			job.id, job.token, now, property, value, target, keep, maxAgeMs, c.bullKey(job.queue, "")).Int()
+	}
+
+	switch {
+	case err != nil:
+		log.Printf("Warning: failed to settle job %s of queue %s, it will be handled again once stalled: %v", job.id, job.queue, err)
+	case code == -1:
+		log.Printf("Warning: job %s of queue %s was removed while being handled", job.id, job.queue)
+	case code == -2:
+		log.Printf("Warning: lost lock on job %s of queue %s before settling it", job.id, job.queue)
+	case code == -3:
+		log.Printf("Warning: job %s of queue %s was no longer active when settled", job.id, job.queue)
+	}
+}
+
+// checkStalled runs BullMQ's stalled check once per lock duration until ctx
+// is done, putting jobs whose worker stopped renewing the lock back in
+// their queues.
+func (c *Consumer) checkStalled(ctx context.Context) {
+	ticker := time.NewTicker(c.LockDuration)
+	defer ticker.Stop()
+	for {
+		for _, queue := range c.Queues {
+			keys := []string{
+				c.bullKey(queue.Name, "stalled"),
+				c.bullKey(queue.Name, "wait"),
+				c.bullKey(queue.Name, "active"),
+				c.bullKey(queue.Name, "failed"),
+				c.bullKey(queue.Name, "stalled-check"),
+				c.bullKey(queue.Name, "meta"),
+				c.bullKey(queue.Name, "paused"),
+				c.bullKey(queue.Name, "marker"),
+				c.bullKey(queue.Name, "events"),
+			}
+			moved, err := bullStalledScript.Run(ctx, c.RDB, keys,
+				c.MaxStalledCount, c.bullKey(queue.Name, ""), time.Now().UnixMilli(), c.LockDuration.Milliseconds()).Int()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: failed to check queue %s for stalled jobs: %v", queue.Name, err)
+				}
+			} else if moved > 0 {
+				log.Printf("Found %d stalled jobs in queue %s", moved, queue.Name)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// bullKey is the key of a BullMQ queue with the given suffix.
+func (c *Consumer) bullKey(queue, suffix string) string {
+	return c.BullMQPrefix + ":" + queue + ":" + suffix
+}
+
+// lockToken returns a token to lock a job with, unique to the worker and
+// the job.
+func lockToken(consumerID string, worker int) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return fmt.Sprintf("%s:%d:%s", consumerID, worker, hex.EncodeToString(b)), nil
+}
+
+// delayedScore is the score BullMQ gives a job delayed until the time in
+// Unix milliseconds.
+func delayedScore(dueMs int64) int64 {
+	return dueMs * 0x1000
+}
+
+// bullBackoff returns the delay in ms before retrying a job that failed
+// attemptsMade times, by its backoff option: a fixed delay in ms, or an
+// object with a type of "fixed" or "exponential" and a delay.
+func bullBackoff(raw json.RawMessage, attemptsMade int) int64 {
+	if len(raw) == 0 {
+		return 0
+	}
+	var delay int64
+	if err := json.Unmarshal(raw, &delay); err == nil {
+		return max(delay, 0)
+	}
+	var backoff struct {
+		Type  string `json:"type"`
+		Delay int64  `json:"delay"`
+	}
+	if err := json.Unmarshal(raw, &backoff); err != nil || backoff.Delay <= 0 {
+		return 0
+	}
+	if backoff.Type == "exponential" {
+		return int64(math.Round(math.Pow(2, float64(attemptsMade-1)) * float64(backoff.Delay)))
+	}
+	return backoff.Delay
+}
+
+// bullKeepJobs returns how many finished jobs to keep, -1 for all, and the
+// age in ms beyond which to remove them, 0 for none, by a removeOnComplete
+// or removeOnFail option: true to remove the job at once, a number of jobs
+// to keep, or an object with a count and an age in seconds.
+func bullKeepJobs(raw json.RawMessage) (keep int, maxAgeMs int64) {
+	if len(raw) == 0 {
+		return -1, 0
+	}
+	var remove bool
+	if err := json.Unmarshal(raw, &remove); err == nil {
+		if remove {
+			return 0, 0
+		}
+		return -1, 0
+	}
+	if err := json.Unmarshal(raw, &keep); err == nil {
+		return max(keep, 0), 0
+	}
+	var opts struct {
+		Count *int  `json:"count"`
+		Age   int64 `json:"age"`
+	}
+	if err := json.Unmarshal(raw, &opts); err != nil {
+		return -1, 0
+	}
+	keep = -1
+	if opts.Count != nil {
+		keep = max(*opts.Count, 0)
+	}
+	return keep, opts.Age * 1000
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBullBackoff(t *testing.T) {
+	tests := []struct {
+		raw          string
+		attemptsMade int
+		want         int64
+	}{
+		{"", 1, 0},
+		{"2000", 1, 2000},
+		{"2000", 5, 2000},
+		{"-5", 1, 0},
+		{`{"type":"fixed","delay":1500}`, 3, 1500},
+		{`{"delay":1500}`, 3, 1500},
+		{`{"type":"exponential","delay":1000}`, 1, 1000},
+		{`{"type":"exponential","delay":1000}`, 2, 2000},
+		{`{"type":"exponential","delay":1000}`, 4, 8000},
+		{`{"type":"exponential","delay":0}`, 4, 0},
+		{`{"type":"exponential"}`, 2, 0},
+		{`"soon"`, 1, 0},
+		{`{"type":"custom","delay":"x"}`, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := bullBackoff(json.RawMessage(tt.raw), tt.attemptsMade); got != tt.want {
+			t.Errorf("bullBackoff(%s, %d) = %d, want %d", tt.raw, tt.attemptsMade, got, tt.want)
+		}
+	}
+}
+
+func TestBullKeepJobs(t *testing.T) {
+	tests := []struct {
+		raw          string
+		wantKeep     int
+		wantMaxAgeMs int64
+	}{
+		{"", -1, 0},
+		{"true", 0, 0},
+		{"false", -1, 0},
+		{"100", 100, 0},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{`{"count":50}`, 50, 0},
+		{`{"age":3600}`, -1, 3600000},
+		{`{"count":10,"age":60}`, 10, 60000},
+		{`{"count":-1}`, 0, 0},
+		{`"all"`, -1, 0},
+	}
+	for _, tt := range tests {
+		keep, maxAgeMs := bullKeepJobs(json.RawMessage(tt.raw))
+		if keep != tt.wantKeep || maxAgeMs != tt.wantMaxAgeMs {
+			t.Errorf("bullKeepJobs(%s) = %d, %d, want %d, %d", tt.raw, keep, maxAgeMs, tt.wantKeep, tt.wantMaxAgeMs)
+		}
+	}
+}
@@ -3,25 +3,61 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"runtime"
+	"sync"
 	"time"
 
+	"judge-service/internal/config"
 	"judge-service/internal/store"
 	"github.com/redis/go-redis/v9"
 )
 
-// Consumer is responsible for listening to the Redis queue.
+// Handler processes one job and returns its result. worker identifies the
+// slot it runs in, from 0 to the number of workers minus one. The result is
+// kept as the return value of BullMQ jobs.
+type Handler func(ctx context.Context, worker int, payload *store.SubmissionPayload) (result any, err error)
+
+// Consumer is responsible for listening to the Redis queues.
+//
+// Delivery is at least once. A worker moves each job it takes into its own
+// processing list for the job's queue, where the job stays until the
+// handler is done with it, and keeps a heartbeat key next to the list alive
+// for as long as the daemon runs. Should the daemon die, the reaper of any
+// consumer on the queue moves the jobs of lists whose heartbeat has expired
+// back onto it.
 type Consumer struct {
-	RDB       *redis.Client
-	QueueName string
+	RDB     *redis.Client
+	Mode    string              // config.QueueModeList or config.QueueModeBullMQ
+	Queues  []config.NamedQueue // Highest priority first
+	Policy  string              // config.QueuePolicyStrict or config.QueuePolicyWeighted
+	Workers int                 // Jobs handled at once
+
+	ID               string // Unique among the consumers of the queue
+	HeartbeatTimeout time.Duration
+
+	MaxAttempts     int // Failures before a job goes to the dead-letter list
+	RetryBackoff    time.Duration
+	RetryBackoffMax time.Duration
+
+	BullMQPrefix    string
+	LockDuration    time.Duration // Of the lock on a BullMQ job
+	MaxStalledCount int
+
+	mu      sync.Mutex
+	credits []int // Smooth weighted round-robin state of the queues
 }
 
 // NewConsumer creates a new queue consumer and pings the Redis server.
-func NewConsumer(redisURL string, queueName string) (*Consumer, error) {
+func NewConsumer(redisURL string, workers int, cfg config.QueueConfig) (*Consumer, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, err
 	}
+	// Every idle worker holds a connection in a blocking pop, which must
+	// not starve the pool.
+	opt.PoolSize = max(opt.PoolSize, 10*runtime.GOMAXPROCS(0), workers+2)
 	rdb := redis.NewClient(opt)
 
 	// Ping the server to ensure connection is alive
@@ -30,23 +66,72 @@ func NewConsumer(redisURL string, queueName string) (*Consumer, error) {
 	}
 
 	return &Consumer{
-		RDB:       rdb,
-		QueueName: queueName,
+		RDB:              rdb,
+		Mode:             cfg.Mode,
+		Queues:           cfg.Queues,
+		Policy:           cfg.Policy,
+		Workers:          workers,
+		ID:               cfg.ConsumerID,
+		HeartbeatTimeout: time.Duration(cfg.HeartbeatTimeoutMs) * time.Millisecond,
+		MaxAttempts:      cfg.MaxAttempts,
+		RetryBackoff:     time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+		RetryBackoffMax:  time.Duration(cfg.RetryBackoffMaxMs) * time.Millisecond,
+		BullMQPrefix:     cfg.BullMQPrefix,
+		LockDuration:     time.Duration(cfg.LockDurationMs) * time.Millisecond,
+		MaxStalledCount:  cfg.MaxStalledCount,
+		credits:          make([]int, len(cfg.Queues)),
 	}, nil
 }
 
-// Start begins listening for jobs on the configured Redis queue.
-func (c *Consumer) Start(ctx context.Context, handler func(context.Context, *store.SubmissionPayload) error) {
-	log.Printf("[*] Waiting for jobs on queue %s", c.QueueName)
+// Start begins listening for jobs on the configured Redis queues with
+// c.Workers workers and returns once all of them have stopped. A worker
+// only pops a job when it is free to handle it, so jobs beyond what the
+// workers can take stay in the queue.
+func (c *Consumer) Start(ctx context.Context, handler Handler) {
+	log.Printf("[*] Waiting for jobs on %s queues %s (%s) with %d workers as consumer %s", c.Mode, queueList(c.Queues), c.Policy, c.Workers, c.ID)
+
+	work := c.work
+	if c.Mode == config.QueueModeBullMQ {
+		work = c.workBullMQ
+		go c.checkStalled(ctx)
+	} else {
+		// The processing lists must be registered and alive before the
+		// first job lands in them.
+		c.beat(ctx)
+		go c.keepAlive(ctx)
+		go c.reapExpired(ctx)
+		go c.promoteDelayed(ctx)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < c.Workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			work(ctx, worker, handler)
+		}(worker)
+	}
+	wg.Wait()
+}
+
+// work takes and handles jobs one at a time until ctx is done. Jobs left in
+// the worker's processing lists by an earlier run of this consumer are put
+// back on their queues first.
+func (c *Consumer) work(ctx context.Context, worker int, handler Handler) {
+	for _, queue := range c.Queues {
+		if n := c.requeue(ctx, c.processingList(queue.Name, worker), queue.Name); n > 0 {
+			log.Printf("Worker %d put %d unfinished jobs back on queue %s", worker, n, queue.Name)
+		}
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Consumer context done. Stopping.")
+			log.Printf("Consumer context done. Stopping worker %d.", worker)
 			return
 		default:
-			// Pop a job from the list, with a 0 timeout for blocking
-			result, err := c.RDB.BLPop(ctx, 0, c.QueueName).Result()
+			// Move a job to the processing list, blocking until there is one
+			queue, jobDataString, err := c.take(ctx, worker)
 			if err != nil {
 				if err == context.Canceled || err == redis.Nil {
 					return // Normal exit condition
@@ -56,31 +141,172 @@ func (c *Consumer) Start(ctx context.Context, handler func(context.Context, *sto
 				continue
 			}
 
-			if len(result) < 2 {
-				continue
-			}
-
-			jobDataString := result[1]
-			log.Printf("Received job data: %s", jobDataString)
+			processing := c.processingList(queue, worker)
+			log.Printf("Worker %d received job data from queue %s: %s", worker, queue, jobDataString)
 
 			var payload store.SubmissionPayload
 			if err := json.Unmarshal([]byte(jobDataString), &payload); err != nil {
 				log.Printf("Error unmarshalling job data %s: %v", jobDataString, err)
+				c.ack(queue, processing, jobDataString)
 				continue
 			}
-			
+
 			// A submission ID must be present
 			if payload.SubmissionID == "" {
 				log.Println("Received job with empty submission ID.")
+				c.ack(queue, processing, jobDataString)
 				continue
 			}
 
-			if err := handler(ctx, &payload); err != nil {
+			if c.route(queue, processing, jobDataString, payload.Priority) {
+				continue
+			}
+
+			_, err = handler(ctx, worker, &payload)
+			if ctx.Err() != nil {
+				// The job was cut short by shutdown, which is no failed
+				// attempt of it. It stays in the processing list, to be
+				// put back on the queue.
+				log.Printf("Left submission %s in %s for the next start", payload.SubmissionID, processing)
+				continue
+			}
+			if err != nil {
 				log.Printf("Error handling job for submission %s: %v", payload.SubmissionID, err)
+				c.fail(queue, processing, jobDataString, err)
 				continue
 			}
 
+			c.ack(queue, processing, jobDataString)
 			log.Printf("Finished processing submission ID: %s", payload.SubmissionID)
 		}
 	}
 }
+
+// ack removes a finished job from a processing list, together with its
+// failed attempts. It does not use the consumer's context, so that a job
+// finished while shutting down is not judged again.
+func (c *Consumer) ack(queue, processing, jobData string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processing, 1, jobData)
+		pipe.HDel(ctx, attemptsKey(queue), jobData)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: failed to remove finished job from %s, it will be judged again: %v", processing, err)
+	}
+}
+
+// requeue moves every job in a processing list back to the front of its
+// queue, oldest first, and returns how many it moved.
+func (c *Consumer) requeue(ctx context.Context, processing, queue string) int {
+	n := 0
+	for {
+		err := c.RDB.LMove(ctx, processing, queue, "RIGHT", "LEFT").Err()
+		if err == redis.Nil {
+			return n
+		}
+		if err != nil {
+			log.Printf("Warning: failed to put jobs in %s back on queue %s: %v", processing, queue, err)
+			return n
+		}
+		n++
+	}
+}
+
+// keepAlive refreshes the heartbeats of the workers until ctx is done.
+func (c *Consumer) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(c.HeartbeatTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.beat(ctx)
+		}
+	}
+}
+
+// beat registers the processing lists of every worker and refreshes their
+// heartbeats.
+func (c *Consumer) beat(ctx context.Context) {
+	_, err := c.RDB.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, queue := range c.Queues {
+			for worker := 0; worker < c.Workers; worker++ {
+				processing := c.processingList(queue.Name, worker)
+				pipe.Set(ctx, heartbeatKey(processing), c.ID, c.HeartbeatTimeout)
+				pipe.SAdd(ctx, registryKey(queue.Name), processing)
+			}
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Warning: failed to send heartbeat for consumer %s: %v", c.ID, err)
+	}
+}
+
+// reapExpired puts the jobs of dead consumers back on the queue, checking
+// once per heartbeat timeout until ctx is done.
+func (c *Consumer) reapExpired(ctx context.Context) {
+	ticker := time.NewTicker(c.HeartbeatTimeout)
+	defer ticker.Stop()
+	for {
+		for _, queue := range c.Queues {
+			c.reap(ctx, queue.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap puts the jobs of every processing list of a queue whose heartbeat
+// has expired back on the queue and unregisters the list.
+func (c *Consumer) reap(ctx context.Context, queue string) {
+	lists, err := c.RDB.SMembers(ctx, registryKey(queue)).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Warning: failed to list processing lists of queue %s: %v", queue, err)
+		}
+		return
+	}
+	for _, processing := range lists {
+		alive, err := c.RDB.Exists(ctx, heartbeatKey(processing)).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Warning: failed to check heartbeat of %s: %v", processing, err)
+			}
+			return
+		}
+		if alive > 0 {
+			continue
+		}
+		if n := c.requeue(ctx, processing, queue); n > 0 {
+			log.Printf("Put %d jobs of expired %s back on queue %s", n, processing, queue)
+		}
+		if err := c.RDB.SRem(ctx, registryKey(queue), processing).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: failed to unregister %s: %v", processing, err)
+		}
+	}
+}
+
+// registryKey is the set of the processing lists of a queue.
+func registryKey(queue string) string {
+	return queue + ":processing"
+}
+
+// processingList is the list holding the job from a queue a worker is
+// handling.
+func (c *Consumer) processingList(queue string, worker int) string {
+	return fmt.Sprintf("%s:processing:%s:%d", queue, c.ID, worker)
+}
+
+// heartbeatKey is the key that exists while the owner of a processing list
+// is alive.
+func heartbeatKey(processing string) string {
+	return processing + ":heartbeat"
+}
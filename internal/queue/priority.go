@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"judge-service/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// idlePoll is how long a worker waits for a job on the first queue, when
+// all queues are empty, before looking at the others again.
+const idlePoll = time.Second
+
+// takeScript moves the first job of the first non-empty queue among the
+// first half of KEYS into the matching processing list in the second half,
+// and returns the queue's position in KEYS with the job.
+var takeScript = redis.NewScript(`
+local n = #KEYS / 2
+for i = 1, n do
+	local job = redis.call("LMOVE", KEYS[i], KEYS[n + i], "LEFT", "RIGHT")
+	if job then
+		return {i, job}
+	end
+end
+return false
+`)
+
+// take moves the next job into the worker's processing list for its queue,
+// blocking until there is one, and returns the queue and the job.
+func (c *Consumer) take(ctx context.Context, worker int) (string, string, error) {
+	first := c.Queues[0].Name
+	if len(c.Queues) == 1 {
+		job, err := c.RDB.BLMove(ctx, first, c.processingList(first, worker), "LEFT", "RIGHT", 0).Result()
+		return first, job, err
+	}
+
+	for {
+		order := c.order()
+		keys := make([]string, 2*len(order))
+		for i, queue := range order {
+			keys[i] = queue
+			keys[len(order)+i] = c.processingList(queue, worker)
+		}
+		taken, err := takeScript.Run(ctx, c.RDB, keys).Slice()
+		if err == nil {
+			if len(taken) != 2 {
+				return "", "", fmt.Errorf("unexpected reply %v to take", taken)
+			}
+			i, _ := taken[0].(int64)
+			job, _ := taken[1].(string)
+			if i < 1 || int(i) > len(order) {
+				return "", "", fmt.Errorf("unexpected reply %v to take", taken)
+			}
+			return order[i-1], job, nil
+		}
+		if err != redis.Nil {
+			return "", "", err
+		}
+
+		// All queues are empty. Jobs of the first queue are taken as soon
+		// as they come, those of the others within idlePoll.
+		job, err := c.RDB.BLMove(ctx, first, c.processingList(first, worker), "LEFT", "RIGHT", idlePoll).Result()
+		if err != redis.Nil {
+			return first, job, err
+		}
+	}
+}
+
+// order returns the queues in the order a job is looked for in them. Under
+// config.QueuePolicyStrict that is their priority. Under
+// config.QueuePolicyWeighted, the queue whose turn it is by smooth weighted
+// round-robin comes first, so that queues with jobs are taken from in
+// proportion to their weights, and the others follow by priority.
+func (c *Consumer) order() []string {
+	order := c.queueNames()
+	if c.Policy != config.QueuePolicyWeighted {
+		return order
+	}
+
+	c.mu.Lock()
+	total, turn := 0, 0
+	for i, queue := range c.Queues {
+		c.credits[i] += queue.Weight
+		total += queue.Weight
+		if c.credits[i] > c.credits[turn] {
+			turn = i
+		}
+	}
+	c.credits[turn] -= total
+	c.mu.Unlock()
+
+	copy(order[1:turn+1], order[:turn])
+	order[0] = c.Queues[turn].Name
+	return order
+}
+
+// route moves a job taken from queue to the end of the queue its priority
+// hint names, if that is another of the consumer's queues, and reports
+// whether it did. A hint naming no queue of the consumer is ignored.
+func (c *Consumer) route(queue, processing, jobData, priority string) bool {
+	if priority == "" || priority == queue {
+		return false
+	}
+	if !c.hasQueue(priority) {
+		log.Printf("Warning: job names unknown queue %s as its priority, judging it from %s", priority, queue)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := moveScript.Run(ctx, c.RDB, []string{processing, priority}, jobData, jobData).Err(); err != nil {
+		log.Printf("Warning: failed to move job to queue %s, judging it from %s: %v", priority, queue, err)
+		return false
+	}
+	log.Printf("Moved job from queue %s to queue %s", queue, priority)
+	return true
+}
+
+// hasQueue reports whether the consumer takes jobs from the named queue.
+func (c *Consumer) hasQueue(name string) bool {
+	for _, queue := range c.Queues {
+		if queue.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// queueNames returns the names of the queues, highest priority first.
+func (c *Consumer) queueNames() []string {
+	names := make([]string, len(c.Queues))
+	for i, queue := range c.Queues {
+		names[i] = queue.Name
+	}
+	return names
+}
+
+// queueList describes queues with their weights for logging.
+func queueList(queues []config.NamedQueue) string {
+	parts := make([]string, len(queues))
+	for i, queue := range queues {
+		parts[i] = fmt.Sprintf("%s:%d", queue.Name, queue.Weight)
+	}
+	return strings.Join(parts, ",")
+}
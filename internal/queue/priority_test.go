@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+
+	"judge-service/internal/config"
+)
+
+func TestOrder(t *testing.T) {
+	queues := []config.NamedQueue{{Name: "contest", Weight: 5}, {Name: "rejudge", Weight: 1}, {Name: "practice", Weight: 2}}
+	tests := []struct {
+		name   string
+		policy string
+		queues []config.NamedQueue
+		takes  int
+		want   map[string]int // How often each queue comes first
+	}{
+		{"strict", config.QueuePolicyStrict, queues, 16, map[string]int{"contest": 16}},
+		{"weighted", config.QueuePolicyWeighted, queues, 16, map[string]int{"contest": 10, "rejudge": 2, "practice": 4}},
+		{"weighted, equal", config.QueuePolicyWeighted, []config.NamedQueue{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}, 6, map[string]int{"a": 3, "b": 3}},
+		{"weighted, one queue", config.QueuePolicyWeighted, []config.NamedQueue{{Name: "a", Weight: 3}}, 4, map[string]int{"a": 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Consumer{Queues: tt.queues, Policy: tt.policy, credits: make([]int, len(tt.queues))}
+			firsts := make(map[string]int)
+			for i := 0; i < tt.takes; i++ {
+				order := c.order()
+				firsts[order[0]]++
+
+				// The others follow by priority.
+				var rest []string
+				for _, queue := range tt.queues {
+					if queue.Name != order[0] {
+						rest = append(rest, queue.Name)
+					}
+				}
+				if len(rest) > 0 && !reflect.DeepEqual(order[1:], rest) {
+					t.Fatalf("take %d: order %v, want %s then %v", i+1, order, order[0], rest)
+				}
+			}
+			if !reflect.DeepEqual(firsts, tt.want) {
+				t.Errorf("queues came first %v times, want %v", firsts, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderWeightedSpread(t *testing.T) {
+	// Smooth weighted round-robin interleaves the queues instead of taking
+	// from the heaviest one in a burst.
+	c := &Consumer{
+		Queues:  []config.NamedQueue{{Name: "a", Weight: 2}, {Name: "b", Weight: 1}},
+		Policy:  config.QueuePolicyWeighted,
+		credits: make([]int, 2),
+	}
+	var firsts []string
+	for i := 0; i < 6; i++ {
+		firsts = append(firsts, c.order()[0])
+	}
+	want := []string{"a", "b", "a", "a", "b", "a"}
+	if !reflect.DeepEqual(firsts, want) {
+		t.Errorf("queues came first in turn %v, want %v", firsts, want)
+	}
+}
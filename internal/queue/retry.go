@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Attempt is a failed attempt at handling a job.
+type Attempt struct {
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetter is a job that failed too often to be retried again.
+type DeadLetter struct {
+	Payload   string    `json:"payload"` // The job data as it was queued
+	LastError string    `json:"lastError"`
+	Attempts  []Attempt `json:"attempts"`
+	DiedAt    time.Time `json:"diedAt"`
+
+	Queue string `json:"-"` // The queue the job came from
+	raw   string // The entry in the dead-letter list
+}
+
+// retryScript moves a failed job from a processing list into the delayed
+// set, to be queued again at the given time, and saves its attempts. It
+// does nothing if the reaper has put the job back on the queue already.
+var retryScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+	redis.call("HSET", KEYS[3], ARGV[1], ARGV[3])
+end
+return 0
+`)
+
+// deadScript moves a failed job from a processing list to the dead-letter
+// list and forgets its attempts, which the dead letter holds.
+var deadScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+end
+return 0
+`)
+
+// promoteScript queues the delayed jobs that are due, oldest first.
+var promoteScript = redis.NewScript(`
+local jobs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 100)
+for _, job in ipairs(jobs) do
+	redis.call("ZREM", KEYS[1], job)
+	redis.call("RPUSH", KEYS[2], job)
+end
+return #jobs
+`)
+
+// moveScript replaces an entry of one list with a value at the end of
+// another, unless the entry is gone.
+var moveScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call("RPUSH", KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// fail records a failed attempt at a job from a queue in a processing list,
+// and either schedules a retry after the backoff or, after c.MaxAttempts
+// failures, moves the job to the queue's dead-letter list.
+func (c *Consumer) fail(queue, processing, jobData string, jobErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var attempts []Attempt
+	history, err := c.RDB.HGet(ctx, attemptsKey(queue), jobData).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Warning: failed to read earlier attempts of job, counting from scratch: %v", err)
+	} else if err == nil {
+		if err := json.Unmarshal([]byte(history), &attempts); err != nil {
+			log.Printf("Warning: invalid attempts %s of job, counting from scratch: %v", history, err)
+			attempts = nil
+		}
+	}
+	now := time.Now()
+	attempts = append(attempts, Attempt{Error: jobErr.Error(), FailedAt: now})
+
+	if len(attempts) >= c.MaxAttempts {
+		letter, _ := json.Marshal(DeadLetter{
+			Payload:   jobData,
+			LastError: jobErr.Error(),
+			Attempts:  attempts,
+			DiedAt:    now,
+		})
+		err = deadScript.Run(ctx, c.RDB, []string{processing, deadKey(queue), attemptsKey(queue)}, jobData, letter).Err()
+		if err == nil {
+			log.Printf("Job failed %d times, moved it to dead-letter list %s", len(attempts), deadKey(queue))
+		}
+	} else {
+		delay := c.backoff(len(attempts))
+		newHistory, _ := json.Marshal(attempts)
+		err = retryScript.Run(ctx, c.RDB, []string{processing, delayedKey(queue), attemptsKey(queue)}, jobData, now.Add(delay).UnixMilli(), newHistory).Err()
+		if err == nil {
+			log.Printf("Job failed %d of %d times, retrying in %v", len(attempts), c.MaxAttempts, delay)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: failed to schedule failed job for retry, it stays in %s until reaped: %v", processing, err)
+	}
+}
+
+// backoff is the delay before retrying a job that failed attempts times.
+func (c *Consumer) backoff(attempts int) time.Duration {
+	delay := c.RetryBackoff
+	for i := 1; i < attempts && delay < c.RetryBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, c.RetryBackoffMax)
+}
+
+// promoteDelayed queues delayed jobs as they fall due, checking every
+// second until ctx is done.
+func (c *Consumer) promoteDelayed(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, queue := range c.Queues {
+				err := promoteScript.Run(ctx, c.RDB, []string{delayedKey(queue.Name), queue.Name}, time.Now().UnixMilli()).Err()
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Warning: failed to queue delayed jobs of %s: %v", queue.Name, err)
+				}
+			}
+		}
+	}
+}
+
+// DeadLetters returns the jobs in the dead-letter lists of the queues, by
+// queue and most recent first.
+func (c *Consumer) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	for _, queue := range c.Queues {
+		entries, err := c.RDB.LRange(ctx, deadKey(queue.Name), 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead-letter list %s: %w", deadKey(queue.Name), err)
+		}
+		for _, entry := range entries {
+			var letter DeadLetter
+			if err := json.Unmarshal([]byte(entry), &letter); err != nil {
+				return nil, fmt.Errorf("invalid dead letter %s: %w", entry, err)
+			}
+			letter.Queue = queue.Name
+			letter.raw = entry
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+// RequeueDeadLetter puts the job of a dead letter returned by DeadLetters
+// back at the end of its queue, to be attempted MaxAttempts times again.
+// It reports false if the letter is no longer in the dead-letter list.
+func (c *Consumer) RequeueDeadLetter(ctx context.Context, letter DeadLetter) (bool, error) {
+	moved, err := moveScript.Run(ctx, c.RDB, []string{deadKey(letter.Queue), letter.Queue}, letter.raw, letter.Payload).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to requeue dead letter: %w", err)
+	}
+	return moved == 1, nil
+}
+
+// attemptsKey is the hash of the failed attempts of a queue's jobs.
+func attemptsKey(queue string) string {
+	return queue + ":attempts"
+}
+
+// delayedKey is the sorted set of a queue's jobs waiting to be retried,
+// scored by when they are due in Unix milliseconds.
+func delayedKey(queue string) string {
+	return queue + ":delayed"
+}
+
+// deadKey is the list of a queue's dead letters.
+func deadKey(queue string) string {
+	return queue + ":dead"
+}
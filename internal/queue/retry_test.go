@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	c := &Consumer{RetryBackoff: time.Second, RetryBackoffMax: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{6, 10 * time.Second},
+		{1000, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := c.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffEdges(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		max      time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{"no backoff", 0, time.Minute, 5, 0},
+		{"base at the cap", time.Minute, time.Minute, 3, time.Minute},
+		{"base above the cap", 2 * time.Minute, time.Minute, 1, time.Minute},
+		{"first attempt", 500 * time.Millisecond, time.Minute, 1, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		c := &Consumer{RetryBackoff: tt.base, RetryBackoffMax: tt.max}
+		if got := c.backoff(tt.attempts); got != tt.want {
+			t.Errorf("%s: backoff(%d) = %v, want %v", tt.name, tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cacheResultFile = "result.json"
+	cacheFilesDir   = "files"
+	cacheTempPrefix = ".tmp-"
+)
+
+// cachedCompile is the outcome of a compilation as stored in the cache.
+type cachedCompile struct {
+	Failed bool   `json:"failed"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// compileCache is a content-addressed store of compilation results on local
+// disk. Each entry is a directory named after its key holding the files the
+// compilation left behind and a result.json; the least recently used
+// entries are evicted once the total size exceeds maxBytes.
+type compileCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	size    int64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// newCompileCache opens the cache in dir, picking up the entries a previous
+// run left there in order of their last use.
+func newCompileCache(dir string, maxBytes int64) (*compileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create compile cache %s: %w", dir, err)
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compile cache %s: %w", dir, err)
+	}
+
+	type found struct {
+		cacheEntry
+		used time.Time
+	}
+	var existing []found
+	for _, de := range dirEntries {
+		path := filepath.Join(dir, de.Name())
+		if strings.HasPrefix(de.Name(), cacheTempPrefix) {
+			// Left over from an interrupted store.
+			os.RemoveAll(path)
+			continue
+		}
+		info, err := os.Stat(filepath.Join(path, cacheResultFile))
+		if err != nil {
+			os.RemoveAll(path)
+			continue
+		}
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		existing = append(existing, found{cacheEntry{key: de.Name(), size: size}, info.ModTime()})
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].used.After(existing[j].used) })
+
+	c := &compileCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	for _, e := range existing {
+		entry := e.cacheEntry
+		c.entries[entry.key] = c.lru.PushBack(&entry)
+		c.size += entry.size
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// compileCacheKey identifies a compilation by everything that can change its
+// outcome.
+func compileCacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%d:%s\x00", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get restores the entry for key into destDir, leaving files that already
+// exist there alone, and returns its result.
+func (c *compileCache) get(key, destDir string) (*cachedCompile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	path := filepath.Join(c.dir, key)
+	result, err := readCachedResult(path)
+	if err == nil {
+		err = copyFiles(filepath.Join(path, cacheFilesDir), destDir, false)
+	}
+	if err != nil {
+		log.Printf("Warning: dropping unreadable compile cache entry %s: %v", key, err)
+		c.removeLocked(elem)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	now := time.Now()
+	os.Chtimes(filepath.Join(path, cacheResultFile), now, now)
+	c.hits.Add(1)
+	return result, true
+}
+
+// put stores the files in srcDir together with result under key.
+func (c *compileCache) put(key, srcDir string, result cachedCompile) error {
+	tmp, err := os.MkdirTemp(c.dir, cacheTempPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create compile cache entry: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filesDir := filepath.Join(tmp, cacheFilesDir)
+	if err := os.Mkdir(filesDir, 0755); err != nil {
+		return err
+	}
+	if err := copyFiles(srcDir, filesDir, true); err != nil {
+		return fmt.Errorf("failed to copy compiled files: %w", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, cacheResultFile), data, 0644); err != nil {
+		return err
+	}
+	size, err := dirSize(tmp)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		// Stored concurrently by another worker.
+		return nil
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("failed to commit compile cache entry: %w", err)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	c.size += size
+	c.evictLocked()
+	return nil
+}
+
+// stats returns the number of hits and misses so far.
+func (c *compileCache) stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func (c *compileCache) evictLocked() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *compileCache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	if err := os.RemoveAll(filepath.Join(c.dir, entry.key)); err != nil {
+		log.Printf("Warning: failed to remove compile cache entry %s: %v", entry.key, err)
+	}
+}
+
+func readCachedResult(path string) (*cachedCompile, error) {
+	data, err := os.ReadFile(filepath.Join(path, cacheResultFile))
+	if err != nil {
+		return nil, err
+	}
+	var result cachedCompile
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// copyFiles copies the regular files directly inside src to dst, keeping
+// their permissions. Existing files in dst are replaced only if overwrite
+// is set.
+func copyFiles(src, dst string, overwrite bool) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		target := filepath.Join(dst, entry.Name())
+		if !overwrite {
+			if _, err := os.Lstat(target); err == nil {
+				continue
+			}
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
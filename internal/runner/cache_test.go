@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entrySize is the size of a cache entry from putFile: its file and its
+// result.json.
+const entrySize = 100 + int64(len(`{"failed":false,"output":"ok"}`))
+
+// putFile stores a compilation that left a 100-byte file named after key.
+func putFile(t *testing.T, c *compileCache, key string) {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, key), []byte(strings.Repeat("x", 100)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.put(key, src, cachedCompile{Output: "ok"}); err != nil {
+		t.Fatalf("put(%s): %v", key, err)
+	}
+}
+
+// cached reports whether key is in c, without counting it as a use.
+func cached(t *testing.T, c *compileCache, key string) bool {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	if _, err := os.Stat(filepath.Join(c.dir, key)); (err == nil) != ok {
+		t.Errorf("cache index and directory disagree about %s", key)
+	}
+	return ok
+}
+
+func TestCompileCacheGet(t *testing.T) {
+	c, err := newCompileCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, c, "a")
+
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "main.cpp"), []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, ok := c.get("a", dest)
+	if !ok || result.Output != "ok" || result.Failed {
+		t.Fatalf("get(a) = %+v, %v", result, ok)
+	}
+	info, err := os.Stat(filepath.Join(dest, "a"))
+	if err != nil || info.Size() != 100 || info.Mode().Perm() != 0755 {
+		t.Errorf("restored file: %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "main.cpp")); string(data) != "source" {
+		t.Errorf("existing file replaced with %q", data)
+	}
+
+	if _, ok := c.get("b", t.TempDir()); ok {
+		t.Errorf("get(b) hit a key never stored")
+	}
+	if hits, misses := c.stats(); hits != 1 || misses != 1 {
+		t.Errorf("stats() = %d hits, %d misses, want 1 and 1", hits, misses)
+	}
+}
+
+func TestCompileCacheEviction(t *testing.T) {
+	c, err := newCompileCache(t.TempDir(), 2*entrySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, c, "a")
+	putFile(t, c, "b")
+	if c.size != 2*entrySize {
+		t.Fatalf("size %d after two entries, want %d", c.size, 2*entrySize)
+	}
+
+	// Using a makes b the least recently used.
+	if _, ok := c.get("a", t.TempDir()); !ok {
+		t.Fatal("get(a) missed")
+	}
+	putFile(t, c, "c")
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if cached(t, c, key) != want {
+			t.Errorf("entry %s cached: %v, want %v", key, !want, want)
+		}
+	}
+	if c.size != 2*entrySize {
+		t.Errorf("size %d after eviction, want %d", c.size, 2*entrySize)
+	}
+
+	// An entry larger than the whole cache does not stay.
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "big"), make([]byte, 3*entrySize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.put("big", src, cachedCompile{}); err != nil {
+		t.Fatal(err)
+	}
+	if cached(t, c, "big") || c.size > c.maxBytes {
+		t.Errorf("oversized entry kept, size %d", c.size)
+	}
+}
+
+func TestCompileCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCompileCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		putFile(t, c, key)
+	}
+	// Last used: b, then c, then a.
+	base := time.Now().Add(-time.Hour)
+	for key, age := range map[string]time.Duration{"a": 3, "b": 1, "c": 2} {
+		used := base.Add(-age * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, key, cacheResultFile), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err = newCompileCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.size != 3*entrySize {
+		t.Errorf("size %d after reload, want %d", c.size, 3*entrySize)
+	}
+	var order []string
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		order = append(order, e.Value.(*cacheEntry).key)
+	}
+	if strings.Join(order, ",") != "b,c,a" {
+		t.Errorf("reloaded in order %v, want b, c, a", order)
+	}
+	if result, ok := c.get("c", t.TempDir()); !ok || result.Output != "ok" {
+		t.Errorf("get(c) after reload = %+v, %v", result, ok)
+	}
+
+	// Reloading into a smaller cache evicts the least recently used.
+	c, err = newCompileCache(dir, 2*entrySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		if cached(t, c, key) != want {
+			t.Errorf("entry %s cached: %v, want %v", key, !want, want)
+		}
+	}
+}
+
+func TestCompileCacheCleanup(t *testing.T) {
+	dir := t.TempDir()
+	for _, leftover := range []string{cacheTempPrefix + "123", "incomplete"} {
+		if err := os.MkdirAll(filepath.Join(dir, leftover, cacheFilesDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := newCompileCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 || c.lru.Len() != 0 || c.size != 0 {
+		t.Errorf("%d leftovers on disk and %d entries of size %d, want none", len(entries), c.lru.Len(), c.size)
+	}
+
+	// Nor does put leave its temporary directory behind.
+	putFile(t, c, "a")
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a" {
+		t.Errorf("cache directory holds %v, want only a", entries)
+	}
+}
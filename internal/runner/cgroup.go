@@ -0,0 +1,291 @@
+//go:build linux
+
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"judge-service/internal/config"
+)
+
+// cgroup2SuperMagic is the filesystem magic number of a cgroup v2 mount.
+const cgroup2SuperMagic = 0x63677270
+
+// cgroupManager owns the delegated cgroup v2 subtree in which every
+// test run gets its own leaf cgroup.
+type cgroupManager struct {
+	root string
+	seq  atomic.Uint64
+
+	// pids is set when the pids controller is delegated to root, so that
+	// leaves can limit their number of tasks.
+	pids bool
+	// cpuset is set when the cpuset controller is delegated to root, so
+	// that leaves can be pinned to CPUs.
+	cpuset bool
+}
+
+// newCgroupManager prepares root for use as the parent of per-run leaves.
+// The memory controller must be available in root (i.e. enabled in the
+// parent's cgroup.subtree_control) so that it can be delegated further;
+// the pids and cpuset controllers are used when available.
+func newCgroupManager(root string) (*cgroupManager, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup root %s: %w", root, err)
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(root, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat cgroup root %s: %w", root, err)
+	}
+	if st.Type != cgroup2SuperMagic {
+		return nil, fmt.Errorf("%s is not on a cgroup v2 filesystem", root)
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read available controllers: %w", err)
+	}
+	if !hasField(string(controllers), "memory") {
+		return nil, fmt.Errorf("memory controller is not delegated to %s", root)
+	}
+	enable := "+memory"
+	pids := hasField(string(controllers), "pids")
+	if pids {
+		enable += " +pids"
+	} else {
+		log.Printf("Warning: pids controller is not delegated to %s; process limits fall back to RLIMIT_NPROC", root)
+	}
+	cpuset := hasField(string(controllers), "cpuset")
+	if cpuset {
+		enable += " +cpuset"
+	} else {
+		log.Printf("Warning: cpuset controller is not delegated to %s; runs are not pinned to CPUs", root)
+	}
+	if err := writeCgroupFile(root, "cgroup.subtree_control", enable); err != nil {
+		return nil, fmt.Errorf("failed to enable controllers in %s: %w", root, err)
+	}
+
+	return &cgroupManager{root: root, pids: pids, cpuset: cpuset}, nil
+}
+
+// cgroup is a leaf cgroup holding the processes of a single run.
+type cgroup struct {
+	path string
+	dir  *os.File // Handed to the sandbox, which joins it with joinCgroup
+}
+
+// create makes a fresh leaf with the given memory limit. Swap is disabled so
+// that the limit cannot be side-stepped by paging out. maxTasks caps the
+// number of processes and threads when the pids controller is available,
+// and cpus, if not empty, the CPUs it may run on when the cpuset controller
+// is.
+func (m *cgroupManager) create(memoryLimitBytes int64, maxTasks int, cpus string) (*cgroup, error) {
+	path := filepath.Join(m.root, fmt.Sprintf("run-%d-%d", os.Getpid(), m.seq.Add(1)))
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", path, err)
+	}
+	cg := &cgroup{path: path}
+
+	if err := writeCgroupFile(path, "memory.max", strconv.FormatInt(memoryLimitBytes, 10)); err != nil {
+		cg.destroy()
+		return nil, err
+	}
+	// memory.swap.max is absent when swap accounting is disabled, in which
+	// case there is nothing to turn off.
+	if err := writeCgroupFile(path, "memory.swap.max", "0"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		cg.destroy()
+		return nil, err
+	}
+	// Kill every process in the leaf together on OOM, not just the largest one.
+	if err := writeCgroupFile(path, "memory.oom.group", "1"); err != nil {
+		cg.destroy()
+		return nil, err
+	}
+	if m.pids {
+		if err := writeCgroupFile(path, "pids.max", strconv.Itoa(maxTasks)); err != nil {
+			cg.destroy()
+			return nil, err
+		}
+	}
+	if m.cpuset && cpus != "" {
+		if err := writeCgroupFile(path, "cpuset.cpus", cpus); err != nil {
+			cg.destroy()
+			return nil, err
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		cg.destroy()
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", path, err)
+	}
+	cg.dir = dir
+	return cg, nil
+}
+
+// availableCPUs returns the CPUs leaves may be pinned to: those of root's
+// effective cpuset, or all the system's without the cpuset controller.
+func (m *cgroupManager) availableCPUs() ([]int, error) {
+	if !m.cpuset {
+		cpus := make([]int, runtime.NumCPU())
+		for i := range cpus {
+			cpus[i] = i
+		}
+		return cpus, nil
+	}
+	data, err := os.ReadFile(filepath.Join(m.root, "cpuset.cpus.effective"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read effective CPUs: %w", err)
+	}
+	return config.ParseCPUList(string(data))
+}
+
+// formatCPUList formats CPU numbers for cpuset.cpus.
+func formatCPUList(cpus []int) string {
+	list := make([]string, len(cpus))
+	for i, cpu := range cpus {
+		list[i] = strconv.Itoa(cpu)
+	}
+	return strings.Join(list, ",")
+}
+
+// oomKilled reports whether the kernel OOM killer fired inside this cgroup.
+func (c *cgroup) oomKilled() (bool, error) {
+	events, err := readKeyedFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false, err
+	}
+	return events["oom_kill"] > 0, nil
+}
+
+// taskLimitHit reports whether a fork or clone in the cgroup failed because
+// of pids.max. It is always false without the pids controller.
+func (c *cgroup) taskLimitHit() (bool, error) {
+	events, err := readKeyedFile(filepath.Join(c.path, "pids.events"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return events["max"] > 0, nil
+}
+
+// peakMemoryKb returns the highest memory usage recorded for the cgroup.
+// memory.peak requires Linux 5.19 or newer.
+func (c *cgroup) peakMemoryKb() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, "memory.peak"))
+	if err != nil {
+		return 0, err
+	}
+	peak, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse memory.peak: %w", err)
+	}
+	return peak / 1024, nil
+}
+
+// cpuUsageUs returns the CPU time consumed by all processes in the cgroup.
+// It is available whether or not the cpu controller is enabled.
+func (c *cgroup) cpuUsageUs() (uint64, error) {
+	stats, err := readKeyedFile(filepath.Join(c.path, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	usage, ok := stats["usage_usec"]
+	if !ok {
+		return 0, fmt.Errorf("usage_usec missing from cpu.stat")
+	}
+	return usage, nil
+}
+
+// destroy kills anything still running in the cgroup and removes it.
+func (c *cgroup) destroy() {
+	if c.dir != nil {
+		c.dir.Close()
+	}
+	// cgroup.kill requires Linux 5.14; on older kernels each process is
+	// killed individually, which may miss ones forked meanwhile until the
+	// next pass.
+	if err := writeCgroupFile(c.path, "cgroup.kill", "1"); err != nil {
+		c.killProcs()
+	}
+
+	// Killed processes are released asynchronously, so rmdir may briefly
+	// report EBUSY.
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = syscall.Rmdir(c.path); err == nil || err == syscall.ENOENT {
+			return
+		}
+		if i%10 == 9 {
+			c.killProcs()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Printf("Warning: failed to remove cgroup %s: %v", c.path, err)
+}
+
+// killProcs sends SIGKILL to every process listed in cgroup.procs.
+func (c *cgroup) killProcs() {
+	data, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+	if err != nil {
+		return
+	}
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write %q to %s: %w", value, path, err)
+	}
+	return nil
+}
+
+// readKeyedFile parses cgroup files made of "key value" lines.
+func readKeyedFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+func hasField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
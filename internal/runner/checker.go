@@ -0,0 +1,133 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"judge-service/internal/store"
+)
+
+// Names of the test files given to checkers and interactors.
+const (
+	judgeInputFile  = "input.txt"
+	judgeOutputFile = "output.txt"
+	judgeAnswerFile = "answer.txt"
+)
+
+// judgeFile is a file made available read-only to a problem's own program.
+type judgeFile struct {
+	Name    string
+	Content string
+}
+
+// Check runs the special judge compiled in checkerDir on the output of one
+// test. It is started as `checker input output answer`, with the three
+// files read-only in its working directory, under the configured checker
+// limits. The exit code and the checker's combined stdout and stderr are
+// returned for interpretation by the caller; err is set when the checker
+// did not exit normally and thus gave no verdict.
+func (r *Runner) Check(checkerDir string, lang string, testCase store.TestCase, output string) (exitCode int, message string, err error) {
+	ctx, cancel := context.WithTimeout(r.Ctx, r.wallLimit(r.sandboxConfig.CheckerTimeLimitMs))
+	defer cancel()
+
+	files := []judgeFile{
+		{judgeInputFile, testCase.Input},
+		{judgeOutputFile, output},
+		{judgeAnswerFile, testCase.Output},
+	}
+	args := []string{judgeInputFile, judgeOutputFile, judgeAnswerFile}
+	exitCode, message, err = r.runJudgeProgram(ctx, checkerDir, lang, args, files, nil, nil)
+	if err != nil {
+		return 0, message, fmt.Errorf("checker: %w", err)
+	}
+	log.Printf("Checker in %s exited with code %d", checkerDir, exitCode)
+	return exitCode, message, nil
+}
+
+// runJudgeProgram runs a program that comes with a problem, compiled in
+// dir, with args appended to its language's RunCmd and files placed in its
+// working directory. It runs under the configured checker limits until it
+// exits or ctx is done. A nil stdout is collected into message along with
+// stderr. err is set when the program did not exit normally.
+func (r *Runner) runJudgeProgram(ctx context.Context, dir string, lang string, args []string, files []judgeFile, stdin io.Reader, stdout io.Writer) (exitCode int, message string, err error) {
+	config, ok := r.LangConfig[lang]
+	if !ok {
+		return 0, "", fmt.Errorf("unsupported language: %s", lang)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	filesDir, err := os.MkdirTemp(os.TempDir(), "judgefiles-")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create test files directory: %w", err)
+	}
+	defer os.RemoveAll(filesDir)
+
+	mounts, err := programMounts(dir)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, file := range files {
+		path := filepath.Join(filesDir, file.Name)
+		if err := os.WriteFile(path, []byte(file.Content), 0644); err != nil {
+			return 0, "", fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+		mounts = append(mounts, mountSpec{Source: path, Target: filepath.Join(sandboxWorkDir, file.Name)})
+	}
+
+	memoryLimitMb := r.sandboxConfig.CheckerMemoryLimitMb
+	vars, err := commandVars(dir, config, memoryLimitMb, false)
+	if err != nil {
+		return 0, "", err
+	}
+	limits := runLimits{
+		CpuTimeMs:     r.sandboxConfig.CheckerTimeLimitMs,
+		MemoryMb:      memoryLimitMb + config.MemoryOverheadMb,
+		FileSizeBytes: uint64(r.sandboxConfig.OutputLimitMb) * 1024 * 1024,
+		MaxProcesses:  config.MaxProcesses,
+	}
+	spec := sandboxSpec{
+		Args:   append(expandArgs(config.RunCmd, vars), args...),
+		Env:    append(append([]string{}, sandboxEnv...), config.EnvList()...),
+		Dir:    sandboxWorkDir,
+		Mounts: append(append(baseMounts(), languageMounts(config)...), mounts...),
+
+		AllowedSyscalls: r.syscalls[lang],
+	}
+	// testlib reports on stderr, but simpler checkers often print to stdout.
+	messages := &limitedBuffer{limit: int64(r.sandboxConfig.StderrLimitKb) * 1024}
+	if stdout == nil {
+		stdout = messages
+	}
+
+	run, err := r.runSandboxed(ctx, cancel, spec, limits, stdin, stdout, messages)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to run %s: %w", dir, err)
+	}
+	message = strings.TrimSpace(messages.String())
+
+	switch {
+	case run.OOMKilled:
+		return 0, message, fmt.Errorf("exceeded the memory limit of %dMB", limits.MemoryMb)
+	case run.TaskLimitHit:
+		return 0, message, fmt.Errorf("exceeded %d processes", limits.MaxProcesses)
+	case run.timeLimitExceeded(limits.CpuTimeMs):
+		return 0, message, fmt.Errorf("exceeded the time limit of %dms", limits.CpuTimeMs)
+	case run.WallLimitHit:
+		return 0, message, fmt.Errorf("exceeded the wall-clock limit")
+	case run.Report == nil:
+		return 0, message, fmt.Errorf("sandbox exited without a report: %v", run.WaitErr)
+	case run.Report.Restricted:
+		return 0, message, fmt.Errorf("made restricted syscall %s", describeSyscall(run.Report.Syscall))
+	case run.Report.Signal != 0:
+		return 0, message, fmt.Errorf("killed by signal %d", run.Report.Signal)
+	}
+	return run.Report.ExitCode, message, nil
+}
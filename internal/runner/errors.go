@@ -0,0 +1,7 @@
+package runner
+
+import "errors"
+
+// ErrCompilationFailed is wrapped by Compile errors caused by the submission
+// itself, as opposed to failures of the judge.
+var ErrCompilationFailed = errors.New("compilation failed")
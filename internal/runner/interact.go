@@ -0,0 +1,81 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"judge-service/internal/store"
+)
+
+// Interact runs the submission in programDir together with the interactor
+// compiled in interactorDir, the stdout of each connected to the stdin of
+// the other. The submission runs under the same limits as in Execute. The
+// interactor is started as `interactor input output answer` under the
+// checker limits, with its wall-clock limit extended by the submission's so
+// that it outlives it; the file it writes as output is discarded.
+func (r *Runner) Interact(programDir string, lang string, interactorDir string, interactorLang string, testCase store.TestCase, timeLimitMs int, memoryLimitMb int, outputLimitMb int) (result store.InteractionResult) {
+	config, ok := r.LangConfig[lang]
+	if !ok {
+		result.Execution.Status = store.StatusInternalError
+		result.Execution.Error = fmt.Sprintf("unsupported language: %s", lang)
+		return
+	}
+
+	toProgram, fromInteractor, err := os.Pipe()
+	if err != nil {
+		result.Execution.Status = store.StatusInternalError
+		result.Execution.Error = fmt.Sprintf("failed to create pipe: %v", err)
+		return
+	}
+	toInteractor, fromProgram, err := os.Pipe()
+	if err != nil {
+		toProgram.Close()
+		fromInteractor.Close()
+		result.Execution.Status = store.StatusInternalError
+		result.Execution.Error = fmt.Sprintf("failed to create pipe: %v", err)
+		return
+	}
+
+	programWall := r.wallLimit(int(float64(timeLimitMs) * config.TimeMultiplier))
+	ctx, cancel := context.WithTimeout(r.Ctx, r.wallLimit(r.sandboxConfig.CheckerTimeLimitMs)+programWall)
+	defer cancel()
+
+	type interactorResult struct {
+		exitCode int
+		message  string
+		err      error
+	}
+	done := make(chan interactorResult, 1)
+	go func() {
+		files := []judgeFile{
+			{judgeInputFile, testCase.Input},
+			{judgeAnswerFile, testCase.Output},
+		}
+		args := []string{judgeInputFile, judgeOutputFile, judgeAnswerFile}
+		exitCode, message, err := r.runJudgeProgram(ctx, interactorDir, interactorLang, args, files, toInteractor, fromInteractor)
+		// Should the interactor not have started, this lets the
+		// submission see EOF rather than wait for it until its own limit.
+		toInteractor.Close()
+		fromInteractor.Close()
+		done <- interactorResult{exitCode, message, err}
+	}()
+
+	result.Execution = r.execute(programDir, lang, toProgram, fromProgram, timeLimitMs, memoryLimitMb, outputLimitMb)
+	toProgram.Close()
+	fromProgram.Close()
+
+	interactor := <-done
+	result.InteractorExitCode = interactor.exitCode
+	result.InteractorMessage = interactor.message
+	if interactor.err != nil {
+		result.InteractorError = fmt.Sprintf("interactor: %v", interactor.err)
+		log.Printf("Interactor in %s failed: %v", interactorDir, interactor.err)
+	} else {
+		log.Printf("Interactor in %s exited with code %d", interactorDir, interactor.exitCode)
+	}
+	return result
+}
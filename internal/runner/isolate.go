@@ -0,0 +1,191 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// sandboxInitArg and sandboxExecArg are the argv[0] values the daemon
+	// re-executes itself with to run the two in-sandbox stages.
+	sandboxInitArg = "judge-sandbox-init"
+	sandboxExecArg = "judge-sandbox-exec"
+
+	// sandboxSpecEnv carries the JSON-encoded sandboxSpec into the sandbox.
+	// It is the only variable the stages see; the program gets spec.Env.
+	sandboxSpecEnv = "JUDGE_SANDBOX_SPEC"
+
+	// sandboxUID and sandboxGID are the IDs submissions run as inside the
+	// user namespace. They map to the daemon's own IDs on the host.
+	sandboxUID = 65534
+	sandboxGID = 65534
+
+	// sandboxWorkDir is the writable, tmpfs-backed working directory.
+	sandboxWorkDir   = "/box"
+	workDirSizeBytes = 64 << 20
+
+	capSysAdmin = 21
+
+	// rlimitNproc is RLIMIT_NPROC, which package syscall does not define.
+	rlimitNproc = 6
+)
+
+// systemMounts are the host paths made visible, read-only, to every program.
+// Paths that do not exist on the host are skipped.
+var systemMounts = []string{
+	"/bin", "/lib", "/lib32", "/lib64", "/libx32", "/usr",
+	"/etc/alternatives", "/etc/ld.so.cache",
+	"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom",
+}
+
+// sandboxEnv is the complete environment of a sandboxed program.
+var sandboxEnv = []string{
+	"PATH=/usr/local/bin:/usr/bin:/bin",
+	"HOME=" + sandboxWorkDir,
+	"LANG=C.UTF-8",
+}
+
+// mountSpec describes one entry of the sandbox filesystem. A mount without
+// a Source is a fresh tmpfs.
+type mountSpec struct {
+	Source    string `json:"source,omitempty"`
+	Target    string `json:"target"`
+	Writable  bool   `json:"writable,omitempty"`
+	SizeBytes int64  `json:"sizeBytes,omitempty"`
+}
+
+// sandboxSpec is everything the in-sandbox stages need to start a program.
+type sandboxSpec struct {
+	Args   []string    `json:"args"`
+	Env    []string    `json:"env"`
+	Dir    string      `json:"dir"`
+	Root   string      `json:"root"`
+	Mounts []mountSpec `json:"mounts"`
+
+	// AllowedSyscalls is the seccomp allowlist; empty means no filter.
+	AllowedSyscalls []int `json:"allowedSyscalls,omitempty"`
+
+	Rlimits []rlimitSpec `json:"rlimits,omitempty"`
+}
+
+// rlimitSpec is a resource limit applied to the program before exec.
+type rlimitSpec struct {
+	Resource int    `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// sandboxReport is written by the init stage once the program has exited.
+type sandboxReport struct {
+	SetupError string `json:"setupError,omitempty"`
+	ExitCode   int    `json:"exitCode"`
+	Signal     int    `json:"signal,omitempty"`
+	Restricted bool   `json:"restricted,omitempty"`
+	Syscall    int    `json:"syscall,omitempty"`
+	UserTimeUs int64  `json:"userTimeUs"`
+	SysTimeUs  int64  `json:"sysTimeUs"`
+	MaxRssKb   int64  `json:"maxRssKb"`
+}
+
+// sandbox is a prepared, not yet started, isolated process.
+type sandbox struct {
+	Cmd     *exec.Cmd
+	reportR *os.File
+	reportW *os.File
+}
+
+// newSandbox builds the command that runs spec inside fresh user, PID,
+// mount, network, IPC and UTS namespaces, with the program joining cg just
+// before it is exec'd. Stdio is left for the caller to wire up. Cancelling
+// ctx kills the sandbox's init process and with it the whole PID namespace.
+func (r *Runner) newSandbox(ctx context.Context, spec sandboxSpec, cg *cgroup) (*sandbox, error) {
+	spec.Root = r.sandboxRoot
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sandbox spec: %w", err)
+	}
+
+	reportR, reportW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report pipe: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{sandboxInitArg}
+	cmd.Env = []string{sandboxSpecEnv + "=" + string(encoded)}
+	// fd 3: report pipe, fd 4: cgroup directory.
+	cmd.ExtraFiles = []*os.File{reportW, cg.dir}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxUID, HostID: os.Geteuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxGID, HostID: os.Getegid(), Size: 1}},
+		// Only needed to assemble the filesystem; dropped before the
+		// program is exec'd.
+		AmbientCaps: []uintptr{capSysAdmin},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+
+	return &sandbox{Cmd: cmd, reportR: reportR, reportW: reportW}, nil
+}
+
+// Start launches the sandbox.
+func (s *sandbox) Start() error {
+	err := s.Cmd.Start()
+	s.reportW.Close()
+	if err != nil {
+		s.reportR.Close()
+	}
+	return err
+}
+
+// Wait waits for the sandbox to exit and returns the init stage's report.
+// A nil report means the sandbox was killed before it could write one.
+func (s *sandbox) Wait() (*sandboxReport, error) {
+	defer s.reportR.Close()
+	waitErr := s.Cmd.Wait()
+
+	var report sandboxReport
+	if err := json.NewDecoder(s.reportR).Decode(&report); err != nil {
+		return nil, waitErr
+	}
+	return &report, nil
+}
+
+// programMounts binds every entry of dir read-only into the working
+// directory, which itself stays writable.
+func programMounts(dir string) ([]mountSpec, error) {
+	mounts := []mountSpec{
+		{Target: sandboxWorkDir, Writable: true, SizeBytes: workDirSizeBytes},
+		{Target: "/tmp", Writable: true, SizeBytes: workDirSizeBytes},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read program directory: %w", err)
+	}
+	for _, entry := range entries {
+		mounts = append(mounts, mountSpec{
+			Source: filepath.Join(dir, entry.Name()),
+			Target: filepath.Join(sandboxWorkDir, entry.Name()),
+		})
+	}
+	return mounts, nil
+}
+
+// baseMounts returns the read-only system mounts present on this host.
+func baseMounts() []mountSpec {
+	var mounts []mountSpec
+	for _, path := range systemMounts {
+		if _, err := os.Lstat(path); err == nil {
+			mounts = append(mounts, mountSpec{Source: path, Target: path})
+		}
+	}
+	return mounts
+}
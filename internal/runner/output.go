@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"errors"
+	"sync"
+)
+
+// errOutputLimit is returned by a limitedBuffer with onExceed set once its
+// limit is reached, which makes exec stop copying from the program's pipe.
+var errOutputLimit = errors.New("output limit exceeded")
+
+// limitedBuffer collects at most limit bytes of a program's output. What
+// happens to the rest depends on onExceed: when set, it is called once and
+// the buffer stops reading, leaving the program blocked on a full pipe until
+// it is killed; otherwise the excess is silently discarded.
+type limitedBuffer struct {
+	mu       sync.Mutex
+	buf      []byte
+	limit    int64
+	exceeded bool
+	onExceed func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exceeded && b.onExceed != nil {
+		return 0, errOutputLimit
+	}
+	if room := b.limit - int64(len(b.buf)); int64(len(p)) > room {
+		b.buf = append(b.buf, p[:room]...)
+		if !b.exceeded {
+			b.exceeded = true
+			if b.onExceed != nil {
+				b.onExceed()
+				return int(room), errOutputLimit
+			}
+		}
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// Exceeded reports whether the program tried to write more than the limit.
+func (b *limitedBuffer) Exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
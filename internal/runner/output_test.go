@@ -0,0 +1,56 @@
+package runner
+
+import "testing"
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name         string
+		writes       []string
+		kill         bool // Set onExceed
+		wantBuf      string
+		wantExceeded bool
+		wantN        []int  // Per write
+		wantErr      []bool // Per write
+	}{
+		{"under", []string{"ab", "c"}, true, "abc", false, []int{2, 1}, []bool{false, false}},
+		{"exactly reached", []string{"abc", "de"}, true, "abcde", false, []int{3, 2}, []bool{false, false}},
+		{"reached, then one more byte", []string{"abcde", "f"}, true, "abcde", true, []int{5, 0}, []bool{false, true}},
+		{"straddled", []string{"abc", "defg"}, true, "abcde", true, []int{3, 2}, []bool{false, true}},
+		{"exceeded at once", []string{"abcdefgh"}, true, "abcde", true, []int{5}, []bool{true}},
+		{"writes after exceeding", []string{"abcdef", "g", "h"}, true, "abcde", true, []int{5, 0, 0}, []bool{true, true, true}},
+		{"discarded, exactly reached", []string{"abcde"}, false, "abcde", false, []int{5}, []bool{false}},
+		{"discarded, straddled", []string{"abc", "defg"}, false, "abcde", true, []int{3, 4}, []bool{false, false}},
+		{"discarded after exceeding", []string{"abcdef", "gh", "i"}, false, "abcde", true, []int{6, 2, 1}, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			b := &limitedBuffer{limit: 5}
+			if tt.kill {
+				b.onExceed = func() { calls++ }
+			}
+			for i, w := range tt.writes {
+				n, err := b.Write([]byte(w))
+				if n != tt.wantN[i] || (err != nil) != tt.wantErr[i] {
+					t.Errorf("write %d of %q = %d, %v, want %d with error %v", i+1, w, n, err, tt.wantN[i], tt.wantErr[i])
+				}
+				if err != nil && err != errOutputLimit {
+					t.Errorf("write %d failed with %v, want errOutputLimit", i+1, err)
+				}
+			}
+			if got := b.String(); got != tt.wantBuf {
+				t.Errorf("buffer holds %q, want %q", got, tt.wantBuf)
+			}
+			if b.Exceeded() != tt.wantExceeded {
+				t.Errorf("Exceeded() = %v, want %v", b.Exceeded(), tt.wantExceeded)
+			}
+			wantCalls := 0
+			if tt.kill && tt.wantExceeded {
+				wantCalls = 1
+			}
+			if calls != wantCalls {
+				t.Errorf("onExceed called %d times, want %d", calls, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"judge-service/internal/config"
+)
+
+// sourceFileFor picks the name a submission is saved under. Languages with
+// a MainClassPattern, such as Java, need the file named after the public
+// class it declares; sources without one, or whose class name is not a
+// plain identifier, keep the configured name. Comments and string literals
+// are left out of the match, so that a class named in them is not taken.
+func sourceFileFor(lang config.Language, sourceCode string) string {
+	if lang.MainClassPattern == "" {
+		return lang.SourceFileName
+	}
+	code := stripCommentsAndStrings(sourceCode)
+	m := regexp.MustCompile(lang.MainClassPattern).FindStringSubmatchIndex(code)
+	if m == nil || m[2] < 0 {
+		return lang.SourceFileName
+	}
+	// A name the pattern cut short, such as A of A$B, is not the class's.
+	name := code[m[2]:m[3]]
+	if !classNamePattern.MatchString(name) || nameContinues.MatchString(code[m[3]:]) {
+		return lang.SourceFileName
+	}
+	return name + filepath.Ext(lang.SourceFileName)
+}
+
+// classNamePattern is the class names a source may be saved after. Java
+// allows more, such as $, but a name that ends up in a command line is
+// better kept plain.
+var classNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// nameContinues matches the rest of a source if it goes on with more of a
+// Java identifier.
+var nameContinues = regexp.MustCompile(`^[\pL\pN_$]`)
+
+// stripCommentsAndStrings blanks out the comments, string and character
+// literals and text blocks of C-like source code. Each is replaced by a
+// space, so that the tokens around it stay apart.
+func stripCommentsAndStrings(source string) string {
+	var b strings.Builder
+	for i := 0; i < len(source); {
+		var open, end string
+		escapes := true
+		switch {
+		case strings.HasPrefix(source[i:], "//"):
+			open, end, escapes = "//", "\n", false
+		case strings.HasPrefix(source[i:], "/*"):
+			open, end, escapes = "/*", "*/", false
+		case strings.HasPrefix(source[i:], `"""`):
+			open, end = `"""`, `"""`
+		case source[i] == '"' || source[i] == '\'':
+			open, end = source[i:i+1], source[i:i+1]
+		default:
+			b.WriteByte(source[i])
+			i++
+			continue
+		}
+		b.WriteByte(' ')
+		for i += len(open); i < len(source) && !strings.HasPrefix(source[i:], end); i++ {
+			if escapes && source[i] == '\\' {
+				i++
+			}
+		}
+		i += len(end)
+	}
+	return b.String()
+}
+
+// findSourceFile returns the name PrepareEnvironment saved the source in
+// dir under.
+func findSourceFile(dir string, lang config.Language) (string, error) {
+	if lang.MainClassPattern == "" {
+		return lang.SourceFileName, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+filepath.Ext(lang.SourceFileName)))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("expected one source file in %s, found %d", dir, len(matches))
+	}
+	return filepath.Base(matches[0]), nil
+}
+
+// commandVars returns the placeholders usable in CompileCmd and RunCmd for
+// the program in dir. memoryLimitMb is the limit before the language's
+// MemoryOverheadMb is added, i.e. what a JVM may use as heap. With shell
+// set the values are quoted, for a command line run by sh -c.
+func commandVars(dir string, lang config.Language, memoryLimitMb int, shell bool) (*strings.Replacer, error) {
+	sourceFile, err := findSourceFile(dir, lang)
+	if err != nil {
+		return nil, err
+	}
+	quote := func(s string) string { return s }
+	if shell {
+		quote = shellQuote
+	}
+	return strings.NewReplacer(
+		"{sourceFile}", quote(sourceFile),
+		"{mainClass}", quote(strings.TrimSuffix(sourceFile, filepath.Ext(sourceFile))),
+		"{memoryMb}", quote(strconv.Itoa(memoryLimitMb)),
+	), nil
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// expandArgs applies vars to every argument of a command.
+func expandArgs(args []string, vars *strings.Replacer) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = vars.Replace(arg)
+	}
+	return expanded
+}
+
+// languageMounts returns read-only mounts for the extra host paths a
+// language's toolchain needs. Paths that do not exist on the host are
+// skipped, as for the system mounts.
+func languageMounts(lang config.Language) []mountSpec {
+	var mounts []mountSpec
+	for _, path := range lang.Mounts {
+		if _, err := os.Lstat(path); err == nil {
+			mounts = append(mounts, mountSpec{Source: path, Target: path})
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package runner
+
+import (
+	"os/exec"
+	"testing"
+
+	"judge-service/internal/config"
+)
+
+func TestStripCommentsAndStrings(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"int a; // b\nint c;", "int a;  int c;"},
+		{"a /* b\nc */ d", "a   d"},
+		{`s = "a \" b"; t`, `s =  ; t`},
+		{`c = '"'; d`, `c =  ; d`},
+		{`c = '\''; d`, `c =  ; d`},
+		{"s = \"\"\"\n\"quoted\" \\\"\"\" \n\"\"\"; t", "s =  ; t"},
+		{`s = ""; t`, `s =  ; t`},
+		{"/* // */ a", "  a"},
+		{`// "` + "\na", " a"},
+		{`"/* " a " */"`, "  a  "},
+		{`a "unterminated`, "a  "},
+		{"a /* unterminated", "a  "},
+		{"a // no newline", "a  "},
+		{`a 'x\`, "a  "},
+	}
+	for _, tt := range tests {
+		if got := stripCommentsAndStrings(tt.source); got != tt.want {
+			t.Errorf("stripCommentsAndStrings(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestSourceFileFor(t *testing.T) {
+	java := config.Language{
+		SourceFileName:   "Main.java",
+		MainClassPattern: `public\s+(?:(?:final|abstract|strictfp)\s+)*class\s+([A-Za-z_][A-Za-z0-9_]*)`,
+	}
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"public class", "import java.util.*;\npublic class Solution {\n}", "Solution.java"},
+		{"final class", "public final class Task_1 {}", "Task_1.java"},
+		{"no public class", "class Solution {}", "Main.java"},
+		{"class in line comment", "// public class Foo\npublic class Bar {}", "Bar.java"},
+		{"class in block comment", "/* public class Foo */\npublic class Bar {}", "Bar.java"},
+		{"class in string", `class A { String s = "public class Foo"; } public class Bar {}`, "Bar.java"},
+		{"class after char literal", `class A { char c = '"'; } public class Bar { String s = "x"; }`, "Bar.java"},
+		{"class in text block", "class A { String s = \"\"\"\npublic class Foo\n\"\"\"; }\npublic class Bar {}", "Bar.java"},
+		{"only in comment", "/* public class Foo */ class Bar {}", "Main.java"},
+		{"unterminated string", `class A { String s = "oops; } public class Bar {}`, "Main.java"},
+		{"unterminated comment", "/* public class Foo\n", "Main.java"},
+		{"dollar in name", "public class A$B {}", "Main.java"},
+		{"name starting with digit", "public class 1A {}", "Main.java"},
+		{"non-ASCII in name", "public class Aé {}", "Main.java"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceFileFor(java, tt.source); got != tt.want {
+				t.Errorf("sourceFileFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	plain := config.Language{SourceFileName: "main.cpp"}
+	if got := sourceFileFor(plain, "public class Foo {}"); got != "main.cpp" {
+		t.Errorf("sourceFileFor without a pattern = %q, want main.cpp", got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"", "Main", "a b", "it's", "''", "$(touch x)", "`id`", `a\"b`, "*", "-x; rm -rf /"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh with %s: %v", shellQuote(s), err)
+		}
+		if string(out) != s {
+			t.Errorf("sh took %s as %q, want %q", shellQuote(s), out, s)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// runLimits bounds the resources of one sandboxed run.
+type runLimits struct {
+	CpuTimeMs     int    // Total CPU time of all processes
+	MemoryMb      int    // Peak memory of all processes
+	FileSizeBytes uint64 // Largest file any process may write
+	MaxProcesses  int    // Processes and threads alive at once
+}
+
+// runResult describes a finished sandboxed run. Report is nil when the
+// sandbox was killed before it could write one.
+type runResult struct {
+	Report  *sandboxReport
+	WaitErr error
+
+	CpuTimeMs    int
+	WallTimeMs   int
+	MemoryUsedKb uint64
+
+	OOMKilled    bool
+	TaskLimitHit bool
+	CPULimitHit  bool // Killed by the CPU watcher
+	WallLimitHit bool // Killed for exceeding ctx's deadline
+}
+
+// signal returns the signal that ended the run, if any.
+func (res *runResult) signal() syscall.Signal {
+	if res.Report == nil {
+		return 0
+	}
+	return syscall.Signal(res.Report.Signal)
+}
+
+// timeLimitExceeded reports whether the run used up its CPU time, whichever
+// of the watcher or RLIMIT_CPU stopped it.
+func (res *runResult) timeLimitExceeded(limitMs int) bool {
+	return res.CPULimitHit || res.CpuTimeMs > limitMs || res.signal() == syscall.SIGXCPU
+}
+
+// runSandboxed runs spec in a fresh sandbox and cgroup under limits, with
+// the given stdio, until it exits or ctx is done. Stdio given as *os.File is
+// closed once the sandbox has started. Calling cancel kills the run; it
+// must cancel ctx. Errors are reserved for failures of the judge
+// itself, not of the program.
+func (r *Runner) runSandboxed(ctx context.Context, cancel context.CancelFunc, spec sandboxSpec, limits runLimits, stdin io.Reader, stdout, stderr io.Writer) (*runResult, error) {
+	cg, err := r.cgroups.create(int64(limits.MemoryMb)*1024*1024, limits.MaxProcesses, r.pinned)
+	if err != nil {
+		return nil, err
+	}
+	defer cg.destroy()
+
+	// RLIMIT_CPU is only a per-process backstop with one-second granularity;
+	// the precise limit is enforced on the cgroup by watchCPU.
+	cpuLimitSec := uint64(limits.CpuTimeMs+999)/1000 + 1
+	spec.Rlimits = append(spec.Rlimits,
+		rlimitSpec{Resource: syscall.RLIMIT_CPU, Soft: cpuLimitSec, Hard: cpuLimitSec + 1},
+		rlimitSpec{Resource: syscall.RLIMIT_FSIZE, Soft: limits.FileSizeBytes, Hard: limits.FileSizeBytes},
+	)
+	if !r.cgroups.pids {
+		// RLIMIT_NPROC is much weaker than pids.max: it also counts the
+		// sandbox's own supervisor and is not enforced at all when the
+		// daemon runs as root on the host.
+		maxProcesses := uint64(limits.MaxProcesses)
+		spec.Rlimits = append(spec.Rlimits, rlimitSpec{Resource: rlimitNproc, Soft: maxProcesses, Hard: maxProcesses})
+	}
+
+	sb, err := r.newSandbox(ctx, spec, cg)
+	if err != nil {
+		return nil, err
+	}
+	sb.Cmd.Stdin = stdin
+	sb.Cmd.Stdout = stdout
+	sb.Cmd.Stderr = stderr
+
+	startTime := time.Now()
+	err = sb.Start()
+	// Files passed as stdio, such as pipe ends shared with another run,
+	// now belong to the sandbox. Keeping them open here would hide the
+	// sandbox's exit from the process at the other end.
+	for _, stdio := range []any{stdin, stdout, stderr} {
+		if f, ok := stdio.(*os.File); ok {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sandbox: %w", err)
+	}
+	stopWatch := watchCPU(cg, limits.CpuTimeMs, cancel)
+	report, waitErr := sb.Wait()
+	res := &runResult{
+		Report:       report,
+		WaitErr:      waitErr,
+		CPULimitHit:  stopWatch(),
+		WallLimitHit: ctx.Err() == context.DeadlineExceeded,
+		WallTimeMs:   int(time.Since(startTime).Milliseconds()),
+	}
+
+	if report != nil {
+		if report.SetupError != "" {
+			return nil, fmt.Errorf("sandbox setup failed: %s", report.SetupError)
+		}
+		res.MemoryUsedKb = uint64(report.MaxRssKb)
+		res.CpuTimeMs = int((report.UserTimeUs + report.SysTimeUs) / 1000)
+	}
+
+	// The cgroup also accounts for threads and children the program did not
+	// wait for, which rusage misses.
+	if usageUs, err := cg.cpuUsageUs(); err == nil {
+		res.CpuTimeMs = int(usageUs / 1000)
+	} else {
+		log.Printf("Warning: falling back to rusage for CPU time: %v", err)
+	}
+
+	// Rusage.Maxrss only covers the largest single process and misses
+	// memory such as page cache charged to the run, so prefer the cgroup.
+	if peakKb, err := cg.peakMemoryKb(); err == nil {
+		res.MemoryUsedKb = peakKb
+	} else {
+		log.Printf("Warning: falling back to maxrss for memory usage: %v", err)
+	}
+
+	if res.OOMKilled, err = cg.oomKilled(); err != nil {
+		log.Printf("Warning: failed to read OOM events: %v", err)
+	}
+	if res.TaskLimitHit, err = cg.taskLimitHit(); err != nil {
+		log.Printf("Warning: failed to read pids events: %v", err)
+	}
+	return res, nil
+}
+
+// wallLimit derives the wall-clock limit of a run from its CPU time limit.
+func (r *Runner) wallLimit(timeLimitMs int) time.Duration {
+	wallMs := float64(timeLimitMs)*r.sandboxConfig.WallTimeMultiplier + float64(r.sandboxConfig.WallTimeExtraMs)
+	return time.Duration(wallMs) * time.Millisecond
+}
+
+// cpuPollInterval is how often watchCPU samples the cgroup's CPU usage.
+const cpuPollInterval = 10 * time.Millisecond
+
+// watchCPU calls kill once the processes in cg have used more than
+// limitMs of CPU time between them. The returned function stops the
+// watcher and reports whether it fired.
+func watchCPU(cg *cgroup, limitMs int, kill func()) (stop func() bool) {
+	done := make(chan struct{})
+	fired := make(chan bool, 1)
+	limitUs := uint64(limitMs) * 1000
+
+	go func() {
+		ticker := time.NewTicker(cpuPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				fired <- false
+				return
+			case <-ticker.C:
+				if usage, err := cg.cpuUsageUs(); err == nil && usage > limitUs {
+					kill()
+					fired <- true
+					return
+				}
+			}
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return <-fired
+	}
+}
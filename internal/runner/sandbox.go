@@ -3,7 +3,6 @@
 package runner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -11,8 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
-	"time"
 
 	"judge-service/internal/config"
 	"judge-service/internal/store"
@@ -21,77 +21,264 @@ import (
 type Runner struct {
 	Ctx        context.Context
 	LangConfig map[string]config.Language
+
+	sandboxConfig config.SandboxConfig
+	cgroups       *cgroupManager
+	sandboxRoot   string
+	syscalls      map[string][]int // Seccomp allowlist per language
+
+	compileCache     *compileCache     // nil when caching is disabled
+	compilerVersions map[string]string // Output of each language's VersionCmd
+
+	cpus   []int  // CPUs available to runs
+	pinned string // cpuset.cpus of this runner's runs, empty if not pinned
+}
+
+func NewRunner(ctx context.Context, langConfig map[string]config.Language, sandboxConfig config.SandboxConfig) (*Runner, error) {
+	syscalls := make(map[string][]int)
+	for lang, cfg := range langConfig {
+		allowed, err := resolveSeccompProfile(cfg.SeccompProfile)
+		if err != nil {
+			return nil, fmt.Errorf("language %s: %w", lang, err)
+		}
+		syscalls[lang] = allowed
+	}
+
+	cgroups, err := newCgroupManager(sandboxConfig.CgroupRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up cgroups: %w", err)
+	}
+	// Each sandbox mounts its own root here in a private mount namespace,
+	// so a single empty directory serves every run.
+	sandboxRoot := filepath.Join(os.TempDir(), "judge-sandbox-root")
+	if err := os.MkdirAll(sandboxRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox root: %w", err)
+	}
+	cpus, err := cgroups.availableCPUs()
+	if err != nil {
+		return nil, err
+	}
+	if len(sandboxConfig.CPUs) > 0 {
+		for _, cpu := range sandboxConfig.CPUs {
+			if !slices.Contains(cpus, cpu) {
+				return nil, fmt.Errorf("CPU %d is not available to the judge", cpu)
+			}
+		}
+		cpus = sandboxConfig.CPUs
+	}
+	r := &Runner{
+		Ctx:           ctx,
+		LangConfig:    langConfig,
+		sandboxConfig: sandboxConfig,
+		cgroups:       cgroups,
+		sandboxRoot:   sandboxRoot,
+		syscalls:      syscalls,
+		cpus:          cpus,
+	}
+	if sandboxConfig.CompileCacheMaxMb > 0 {
+		if err := r.setupCompileCache(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
 }
 
-func NewRunner(ctx context.Context, langConfig map[string]config.Language) *Runner {
-	return &Runner{
-		Ctx:        ctx,
-		LangConfig: langConfig,
+// setupCompileCache opens the compile cache and records the compiler
+// versions that go into its keys. The versions are taken once at startup,
+// so upgrading a compiler requires restarting the daemon. Languages whose
+// version cannot be determined are compiled without the cache.
+func (r *Runner) setupCompileCache() error {
+	cache, err := newCompileCache(r.sandboxConfig.CompileCacheDir, int64(r.sandboxConfig.CompileCacheMaxMb)*1024*1024)
+	if err != nil {
+		return err
+	}
+	versions := make(map[string]string)
+	for lang, cfg := range r.LangConfig {
+		if cfg.VersionCmd == "" {
+			versions[lang] = ""
+			continue
+		}
+		out, err := exec.CommandContext(r.Ctx, "sh", "-c", cfg.VersionCmd).CombinedOutput()
+		if err != nil {
+			log.Printf("Warning: not caching compilations for %s, failed to get compiler version: %v", lang, err)
+			continue
+		}
+		versions[lang] = string(out)
 	}
+	r.compileCache = cache
+	r.compilerVersions = versions
+	return nil
+}
+
+// CPUs returns the CPUs runs may be pinned to.
+func (r *Runner) CPUs() []int {
+	return r.cpus
 }
 
-func (r *Runner) Execute(executablePath string, testCase store.TestCase, timeLimitMs int, memoryLimitMb int) (result store.ExecutionResult) {
-	log.Printf("Executing %s with time limit %dms (wall-clock), memory limit %dMB", executablePath, timeLimitMs, memoryLimitMb)
+// Bind returns a copy of r whose runs are stopped when ctx is done and, if
+// cpus is not empty, pinned to those CPUs.
+func (r *Runner) Bind(ctx context.Context, cpus []int) *Runner {
+	bound := *r
+	bound.Ctx = ctx
+	bound.pinned = formatCPUList(cpus)
+	return &bound
+}
+
+// Execute runs the language's RunCmd in programDir against one test case.
+// timeLimitMs bounds the CPU time of all its processes together; the
+// wall-clock limit is derived from it so that programs blocked on input or
+// sleeping are stopped too. Time and memory limits are scaled by the
+// language's multipliers. outputLimitMb bounds both stdout and every file
+// the program writes; 0 uses the configured default.
+func (r *Runner) Execute(programDir string, lang string, testCase store.TestCase, timeLimitMs int, memoryLimitMb int, outputLimitMb int) store.ExecutionResult {
+	return r.execute(programDir, lang, strings.NewReader(testCase.Input), nil, timeLimitMs, memoryLimitMb, outputLimitMb)
+}
+
+// execute implements Execute with the program's stdio given by the caller.
+// A nil stdout is captured into the result's Output, subject to the output
+// limit; otherwise stdout is only passed through.
+func (r *Runner) execute(programDir string, lang string, stdin io.Reader, stdout io.Writer, timeLimitMs int, memoryLimitMb int, outputLimitMb int) (result store.ExecutionResult) {
+	config, ok := r.LangConfig[lang]
+	if !ok {
+		result.Status = store.StatusInternalError
+		result.Error = fmt.Sprintf("unsupported language: %s", lang)
+		return
+	}
+	timeLimitMs = int(float64(timeLimitMs) * config.TimeMultiplier)
+	programMemoryMb := int(float64(memoryLimitMb) * config.MemoryMultiplier)
+	memoryLimitMb = programMemoryMb + config.MemoryOverheadMb
+	if outputLimitMb <= 0 {
+		outputLimitMb = r.sandboxConfig.OutputLimitMb
+	}
+	outputLimitBytes := uint64(outputLimitMb) * 1024 * 1024
+	wallLimit := r.wallLimit(timeLimitMs)
+	log.Printf("Executing %s in %s with CPU time limit %dms, wall-clock limit %s, memory limit %dMB, output limit %dMB", config.DisplayName, programDir, timeLimitMs, wallLimit, memoryLimitMb, outputLimitMb)
 
-	ctx, cancel := context.WithTimeout(r.Ctx, time.Duration(timeLimitMs)*time.Millisecond)
+	ctx, cancel := context.WithTimeout(r.Ctx, wallLimit)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, executablePath)
-	cmd.Dir = filepath.Dir(executablePath)
+	mounts, err := programMounts(programDir)
+	if err != nil {
+		result.Status = store.StatusInternalError
+		result.Error = err.Error()
+		return
+	}
+	vars, err := commandVars(programDir, config, programMemoryMb, false)
+	if err != nil {
+		result.Status = store.StatusInternalError
+		result.Error = err.Error()
+		return
+	}
+	spec := sandboxSpec{
+		Args:   expandArgs(config.RunCmd, vars),
+		Env:    append(append([]string{}, sandboxEnv...), config.EnvList()...),
+		Dir:    sandboxWorkDir,
+		Mounts: append(append(baseMounts(), languageMounts(config)...), mounts...),
+
+		AllowedSyscalls: r.syscalls[lang],
+	}
+	maxProcesses := config.MaxProcesses
+	limits := runLimits{
+		CpuTimeMs:     timeLimitMs,
+		MemoryMb:      memoryLimitMb,
+		FileSizeBytes: outputLimitBytes,
+		MaxProcesses:  maxProcesses,
+	}
+
+	// A program flooding stdout is killed as soon as it passes the limit
+	// rather than when the time limit catches up with it; excess stderr is
+	// only dropped.
+	var captured *limitedBuffer
+	if stdout == nil {
+		captured = &limitedBuffer{limit: int64(outputLimitBytes), onExceed: cancel}
+		stdout = captured
+	}
+	stderr := &limitedBuffer{limit: int64(r.sandboxConfig.StderrLimitKb) * 1024}
 
-	stdinPipe, err := cmd.StdinPipe()
+	run, err := r.runSandboxed(ctx, cancel, spec, limits, stdin, stdout, stderr)
 	if err != nil {
 		result.Status = store.StatusInternalError
-		result.Error = fmt.Sprintf("failed to create stdin pipe: %v", err)
+		result.Error = err.Error()
+		log.Printf("Failed to run %s: %v", programDir, err)
 		return
 	}
-	go func() {
-		defer stdinPipe.Close()
-		io.WriteString(stdinPipe, testCase.Input)
-	}()
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	var wallClockTime time.Duration
-	var cpuTimeMs int
-	var memUsageKb uint64
-
-	startTime := time.Now()
-	err = cmd.Run()
-	wallClockTime = time.Since(startTime)
-
-	if cmd.ProcessState != nil {
-		if rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
-			memUsageKb = uint64(rusage.Maxrss)
-			userCpuTimeMs := (rusage.Utime.Sec * 1000) + (rusage.Utime.Usec / 1000)
-			sysCpuTimeMs := (rusage.Stime.Sec * 1000) + (rusage.Stime.Usec / 1000)
-			cpuTimeMs = int(userCpuTimeMs + sysCpuTimeMs)
-		}
+
+	result.CpuTimeMs = run.CpuTimeMs
+	result.WallTimeMs = run.WallTimeMs
+	result.MemoryUsedKb = run.MemoryUsedKb
+	if overheadKb := uint64(config.MemoryOverheadMb) * 1024; result.MemoryUsedKb > overheadKb {
+		result.MemoryUsedKb -= overheadKb
+	} else {
+		result.MemoryUsedKb = 0
+	}
+	if run.Report != nil {
+		result.ExitCode = run.Report.ExitCode
+		result.Signal = run.Report.Signal
+	}
+
+	// A managed runtime hitting its own heap limit usually fails with an
+	// error of its own before the cgroup OOM killer has to step in.
+	runtimeOOM := config.OutOfMemoryMarker != "" && strings.Contains(stderr.String(), config.OutOfMemoryMarker)
+	if run.OOMKilled || runtimeOOM {
+		result.Status = store.StatusMemoryLimitExceeded
+		log.Printf("Memory limit exceeded for %s. Peak memory: %dKB", programDir, result.MemoryUsedKb)
+		return
+	}
+
+	if (captured != nil && captured.Exceeded()) || run.signal() == syscall.SIGXFSZ {
+		result.Status = store.StatusOutputLimitExceeded
+		log.Printf("Output limit exceeded for %s", programDir)
+		return
+	}
+
+	if run.TaskLimitHit {
+		result.Status = store.StatusProcessLimitExceeded
+		result.Error = fmt.Sprintf("more than %d processes or threads", maxProcesses)
+		log.Printf("Process limit exceeded for %s", programDir)
+		return
 	}
 
-	if ctx.Err() == context.DeadlineExceeded {
+	if run.timeLimitExceeded(timeLimitMs) {
 		result.Status = store.StatusTimeLimitExceeded
-		result.ExecutionTimeMs = int(wallClockTime.Milliseconds())
-		result.MemoryUsedKb = memUsageKb
-		log.Printf("Submission timed out. Wall-clock time: %s", wallClockTime)
+		log.Printf("Time limit exceeded for %s. CPU time: %dms", programDir, result.CpuTimeMs)
+		return
+	}
+
+	if run.WallLimitHit {
+		result.Status = store.StatusIdlenessLimitExceeded
+		log.Printf("Idleness limit exceeded for %s. Wall-clock time: %dms, CPU time: %dms", programDir, result.WallTimeMs, result.CpuTimeMs)
 		return
 	}
 
-	result.ExecutionTimeMs = cpuTimeMs
-	result.MemoryUsedKb = memUsageKb
+	report := run.Report
+	if report == nil {
+		result.Status = store.StatusInternalError
+		result.Error = fmt.Sprintf("sandbox exited without a report: %v", run.WaitErr)
+		return
+	}
 
-	if err != nil {
+	if report.Restricted || report.Signal == int(syscall.SIGSYS) {
+		result.Status = store.StatusRestrictedFunction
+		result.Error = "restricted syscall via foreign ABI"
+		if report.Restricted {
+			result.Error = "restricted syscall " + describeSyscall(report.Syscall)
+		}
+		log.Printf("Restricted function in %s: %s", programDir, result.Error)
+		return
+	}
+
+	if report.ExitCode != 0 || report.Signal != 0 {
 		result.Status = store.StatusRuntimeError
 		result.Error = stderr.String()
-		log.Printf("Runtime error for %s. CPU time: %dms. Stderr: %s", executablePath, cpuTimeMs, stderr.String())
+		log.Printf("Runtime error for %s: %s. CPU time: %dms. Stderr: %s", programDir, result.ExitReason(), result.CpuTimeMs, stderr.String())
 		return
 	}
 
 	result.Status = store.StatusCompleted
-	result.Output = stdout.String()
-	log.Printf("Execution completed for %s. CPU Time: %dms, Memory: %dKB", executablePath, result.ExecutionTimeMs, result.MemoryUsedKb)
+	if captured != nil {
+		result.Output = captured.String()
+	}
+	log.Printf("Execution completed for %s. CPU Time: %dms, Wall Time: %dms, Memory: %dKB", programDir, result.CpuTimeMs, result.WallTimeMs, result.MemoryUsedKb)
 	return result
 }
 
@@ -106,7 +293,7 @@ func (r *Runner) PrepareEnvironment(submissionID string, sourceCode string, lang
 		return "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
-	sourceFilePath := filepath.Join(tempDir, config.SourceFileName)
+	sourceFilePath := filepath.Join(tempDir, sourceFileFor(config, sourceCode))
 	if err := os.WriteFile(sourceFilePath, []byte(sourceCode), 0644); err != nil {
 		os.RemoveAll(tempDir)
 		return "", fmt.Errorf("failed to write source code: %w", err)
@@ -114,29 +301,125 @@ func (r *Runner) PrepareEnvironment(submissionID string, sourceCode string, lang
 	return tempDir, nil
 }
 
-func (r *Runner) Compile(tempDir string, lang string) (executablePath string, compileOutput string, err error) {
+// Compile builds the submission in tempDir inside the sandbox, under the
+// language's compile limits, leaving the result next to the source for
+// Execute. Errors wrapping ErrCompilationFailed are the submission's fault
+// and come with the compiler's combined stdout and stderr; any other error
+// is the judge's. Results, including compilation errors, are served from
+// the compile cache when possible.
+func (r *Runner) Compile(tempDir string, lang string) (compileOutput string, err error) {
 	config, ok := r.LangConfig[lang]
 	if !ok {
-		return "", "", fmt.Errorf("unsupported language: %s", lang)
+		return "", fmt.Errorf("unsupported language: %s", lang)
 	}
 
 	if config.CompileCmd == "" {
-		return filepath.Join(tempDir, config.SourceFileName), "", nil
+		return "", nil
 	}
+	version, ok := r.compilerVersions[lang]
+	if r.compileCache == nil || !ok {
+		compileOutput, _, err = r.compile(tempDir, config)
+		return compileOutput, err
+	}
+
+	sourceFile, err := findSourceFile(tempDir, config)
+	if err != nil {
+		return "", err
+	}
+	source, err := os.ReadFile(filepath.Join(tempDir, sourceFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read source code: %w", err)
+	}
+	key := compileCacheKey(lang, version, config.CompileCmd, sourceFile,
+		fmt.Sprintf("%+v", config.Compile), string(source))
 
-	ctx, cancel := context.WithTimeout(r.Ctx, 30*time.Second)
+	if cached, ok := r.compileCache.get(key, tempDir); ok {
+		hits, misses := r.compileCache.stats()
+		log.Printf("Compile cache hit for %s (key %.12s, %d hits, %d misses)", tempDir, key, hits, misses)
+		if cached.Failed {
+			return cached.Output, fmt.Errorf("%w: %s", ErrCompilationFailed, cached.Error)
+		}
+		return cached.Output, nil
+	}
+
+	compileOutput, cacheable, err := r.compile(tempDir, config)
+	if cacheable {
+		result := cachedCompile{Failed: err != nil, Output: compileOutput}
+		if err != nil {
+			result.Error = strings.TrimPrefix(err.Error(), ErrCompilationFailed.Error()+": ")
+		}
+		if err := r.compileCache.put(key, tempDir, result); err != nil {
+			log.Printf("Warning: failed to cache compilation of %s: %v", tempDir, err)
+		}
+	}
+	return compileOutput, err
+}
+
+// compile runs the compiler for a language that has one. cacheable is false
+// for outcomes that may differ on another attempt, such as internal errors
+// and running out of time on a busy host.
+func (r *Runner) compile(tempDir string, config config.Language) (compileOutput string, cacheable bool, err error) {
+	vars, err := commandVars(tempDir, config, config.Compile.MemoryLimitMb, true)
+	if err != nil {
+		return "", false, err
+	}
+	limits := runLimits{
+		CpuTimeMs:     config.Compile.TimeLimitMs,
+		MemoryMb:      config.Compile.MemoryLimitMb,
+		FileSizeBytes: uint64(config.Compile.OutputLimitMb) * 1024 * 1024,
+		MaxProcesses:  config.Compile.MaxProcesses,
+	}
+	ctx, cancel := context.WithTimeout(r.Ctx, r.wallLimit(limits.CpuTimeMs))
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", config.CompileCmd)
-	cmd.Dir = tempDir
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	// The compiler writes its output straight into tempDir.
+	spec := sandboxSpec{
+		Args: []string{"sh", "-c", vars.Replace(config.CompileCmd)},
+		Env:  sandboxEnv,
+		Dir:  sandboxWorkDir,
+		Mounts: append(append(baseMounts(), languageMounts(config)...),
+			mountSpec{Source: tempDir, Target: sandboxWorkDir, Writable: true},
+			mountSpec{Target: "/tmp", Writable: true, SizeBytes: workDirSizeBytes},
+		),
+	}
+	output := &limitedBuffer{limit: int64(r.sandboxConfig.CompileOutputLimitKb) * 1024}
 
-	if err := cmd.Run(); err != nil {
-		return "", stderr.String(), fmt.Errorf("compilation failed: %w", err)
+	run, err := r.runSandboxed(ctx, cancel, spec, limits, nil, output, output)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to run compiler: %w", err)
+	}
+
+	compileOutput = output.String()
+	if output.Exceeded() {
+		compileOutput += "\n... (output truncated)"
 	}
 
-	return filepath.Join(tempDir, config.ExecutableFileName), "", nil
+	var reason string
+	cacheable = true
+	switch {
+	case run.OOMKilled:
+		reason = fmt.Sprintf("compiler exceeded the memory limit of %dMB", limits.MemoryMb)
+	case run.signal() == syscall.SIGXFSZ:
+		reason = fmt.Sprintf("compiler output exceeded %dMB", config.Compile.OutputLimitMb)
+	case run.TaskLimitHit:
+		reason = fmt.Sprintf("compiler exceeded %d processes", limits.MaxProcesses)
+	case run.timeLimitExceeded(limits.CpuTimeMs):
+		reason = fmt.Sprintf("compilation exceeded the time limit of %dms", limits.CpuTimeMs)
+		cacheable = false
+	case run.WallLimitHit:
+		reason = "compilation exceeded the wall-clock limit"
+		cacheable = false
+	case run.Report == nil:
+		return compileOutput, false, fmt.Errorf("compiler sandbox exited without a report: %v", run.WaitErr)
+	case run.Report.ExitCode != 0 || run.Report.Signal != 0:
+		return compileOutput, true, fmt.Errorf("%w: exit code %d, signal %d", ErrCompilationFailed, run.Report.ExitCode, run.Report.Signal)
+	default:
+		return compileOutput, true, nil
+	}
+	if compileOutput != "" {
+		compileOutput += "\n"
+	}
+	return compileOutput + reason, cacheable, fmt.Errorf("%w: %s", ErrCompilationFailed, reason)
 }
 
 func (r *Runner) CleanUp(tempDir string) {
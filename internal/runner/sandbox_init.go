@@ -0,0 +1,341 @@
+//go:build linux
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+const (
+	prSetNoNewPrivs       = 38
+	prCapAmbient          = 47
+	prCapAmbientClearAll  = 4
+	statfsLockedFlagsMask = syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME
+	stRelatime            = 0x1000
+)
+
+// The daemon re-executes itself to run the sandbox stages, so they must take
+// over before main runs.
+func init() {
+	if len(os.Args) == 0 {
+		return
+	}
+	switch os.Args[0] {
+	case sandboxInitArg:
+		runSandboxInit()
+	case sandboxExecArg:
+		runSandboxExec()
+	}
+}
+
+// runSandboxInit is PID 1 of the sandbox. It starts the exec stage, waits for
+// the program to finish and reports how it ended on fd 3. When it returns,
+// the kernel kills whatever is left in the PID namespace.
+func runSandboxInit() {
+	reportFile := os.NewFile(3, "report")
+	cgroupDir := os.NewFile(4, "cgroup")
+
+	// The program can signal PID 1 too, and the kernel delivers it any
+	// signal we handle, which the Go runtime does for nearly all of them,
+	// many fatally. Catch and drop them all, so the report always gets
+	// written. Caught rather than ignored, they do not stay ignored in the
+	// program.
+	signal.Notify(make(chan os.Signal, 1))
+
+	report := superviseProgram(cgroupDir)
+	json.NewEncoder(reportFile).Encode(report)
+	os.Exit(0)
+}
+
+func superviseProgram(cgroupDir *os.File) sandboxReport {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxSpecEnv)), &spec); err != nil {
+		return sandboxReport{SetupError: fmt.Sprintf("failed to decode sandbox spec: %v", err)}
+	}
+	// Restricted syscalls are reported to us through ptrace, and ptrace
+	// requests must all come from the thread that started the tracee.
+	traced := len(spec.AllowedSyscalls) > 0
+	if traced {
+		runtime.LockOSThread()
+	}
+
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return sandboxReport{SetupError: fmt.Sprintf("failed to create error pipe: %v", err)}
+	}
+	defer errR.Close()
+
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = []string{sandboxExecArg}
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// fd 3: cgroup directory, fd 4: setup error pipe.
+	cmd.ExtraFiles = []*os.File{cgroupDir, errW}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Pdeathsig: syscall.SIGKILL,
+		Ptrace:    traced,
+	}
+
+	err = cmd.Start()
+	errW.Close()
+	if err != nil {
+		return sandboxReport{SetupError: fmt.Sprintf("failed to start exec stage: %v", err)}
+	}
+
+	// The error pipe is close-on-exec in the exec stage, so it reads EOF
+	// without data once the program has been exec'd successfully. A traced
+	// stage only gets that far while we are running the trace loop.
+	setupErrCh := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(errR)
+		setupErrCh <- data
+	}()
+
+	var exit programExit
+	if traced {
+		exit, err = traceProgram(cmd.Process.Pid)
+	} else {
+		exit, err = waitProgram(cmd.Process.Pid)
+	}
+	// Whatever the program left running in the background must not outlive
+	// it, nor keep the output pipes open.
+	syscall.Kill(-1, syscall.SIGKILL)
+
+	if setupErr := <-setupErrCh; len(setupErr) > 0 {
+		return sandboxReport{SetupError: string(setupErr)}
+	}
+	if err != nil {
+		return sandboxReport{SetupError: fmt.Sprintf("failed to wait for program: %v", err)}
+	}
+
+	report := sandboxReport{
+		ExitCode:   exit.Status.ExitStatus(),
+		Restricted: exit.Restricted,
+		Syscall:    exit.Syscall,
+		UserTimeUs: exit.Rusage.Utime.Sec*1e6 + exit.Rusage.Utime.Usec,
+		SysTimeUs:  exit.Rusage.Stime.Sec*1e6 + exit.Rusage.Stime.Usec,
+		MaxRssKb:   exit.Rusage.Maxrss,
+	}
+	if exit.Status.Signaled() {
+		report.Signal = int(exit.Status.Signal())
+	}
+	return report
+}
+
+// runSandboxExec assembles the sandbox filesystem, moves itself into the
+// run's cgroup, drops its privileges and replaces itself with the program.
+// Anything it does before the exec is not charged to the submission.
+func runSandboxExec() {
+	// Capabilities are per thread; keep the one that drops them for the exec.
+	runtime.LockOSThread()
+
+	errPipe := os.NewFile(4, "error")
+	err := execProgram()
+	fmt.Fprint(errPipe, err)
+	os.Exit(1)
+}
+
+func execProgram() error {
+	syscall.CloseOnExec(3)
+	syscall.CloseOnExec(4)
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxSpecEnv)), &spec); err != nil {
+		return fmt.Errorf("failed to decode sandbox spec: %w", err)
+	}
+	if len(spec.Args) == 0 {
+		return fmt.Errorf("no program to run")
+	}
+
+	if err := setupFilesystem(spec); err != nil {
+		return err
+	}
+	if err := syscall.Sethostname([]byte("sandbox")); err != nil {
+		return fmt.Errorf("failed to set hostname: %w", err)
+	}
+	for _, rl := range spec.Rlimits {
+		limit := syscall.Rlimit{Cur: rl.Soft, Max: rl.Hard}
+		if err := syscall.Setrlimit(rl.Resource, &limit); err != nil {
+			return fmt.Errorf("failed to set rlimit %d: %w", rl.Resource, err)
+		}
+	}
+	if err := joinCgroup(3); err != nil {
+		return err
+	}
+	if err := syscall.Chdir(spec.Dir); err != nil {
+		return fmt.Errorf("failed to enter %s: %w", spec.Dir, err)
+	}
+	path, err := lookPath(spec.Args[0], spec.Env)
+	if err != nil {
+		return err
+	}
+	if err := dropPrivileges(); err != nil {
+		return err
+	}
+	// Only compilers run without an allowlist; resolveSeccompProfile never
+	// yields an empty one for a program.
+	if len(spec.AllowedSyscalls) > 0 {
+		if err := installSeccomp(spec.AllowedSyscalls); err != nil {
+			return err
+		}
+	}
+
+	err = syscall.Exec(path, spec.Args, spec.Env)
+	return fmt.Errorf("failed to exec %s: %w", path, err)
+}
+
+// setupFilesystem builds the sandbox root on a tmpfs at spec.Root, pivots
+// into it and makes it read-only. The host filesystem is detached entirely,
+// and /proc is deliberately never mounted.
+func setupFilesystem(spec sandboxSpec) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if err := syscall.Mount("tmpfs", spec.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=0755"); err != nil {
+		return fmt.Errorf("failed to mount sandbox root: %w", err)
+	}
+	for _, m := range spec.Mounts {
+		if err := mountInto(spec.Root, m); err != nil {
+			return fmt.Errorf("failed to mount %s: %w", m.Target, err)
+		}
+	}
+
+	if err := syscall.Chdir(spec.Root); err != nil {
+		return fmt.Errorf("failed to enter sandbox root: %w", err)
+	}
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot root: %w", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host filesystem: %w", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("failed to make sandbox root read-only: %w", err)
+	}
+	return nil
+}
+
+func mountInto(root string, m mountSpec) error {
+	target := filepath.Join(root, m.Target)
+
+	if m.Source == "" {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		data := fmt.Sprintf("size=%d,mode=0755", m.SizeBytes)
+		return syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, data)
+	}
+
+	info, err := os.Lstat(m.Source)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		// Keep symlinks such as /bin -> usr/bin as symlinks so they
+		// resolve inside the sandbox.
+		dest, err := os.Readlink(m.Source)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(dest, target)
+	case info.IsDir():
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	default:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	if err := syscall.Mount(m.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if m.Writable {
+		return nil
+	}
+
+	// A read-only remount inside a user namespace must keep the flags the
+	// host locked on the source mount, or the kernel refuses it.
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_NOSUID)
+	flags |= uintptr(st.Flags) & statfsLockedFlagsMask
+	if st.Flags&stRelatime != 0 {
+		flags |= syscall.MS_RELATIME
+	}
+	return syscall.Mount("", target, "", flags, "")
+}
+
+// joinCgroup moves the calling process into the cgroup whose directory is
+// open as fd, so only the program itself is charged to it.
+func joinCgroup(fd int) error {
+	procs, err := syscall.Openat(fd, "cgroup.procs", syscall.O_WRONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open cgroup.procs: %w", err)
+	}
+	defer syscall.Close(procs)
+	if _, err := syscall.Write(procs, []byte("0")); err != nil {
+		return fmt.Errorf("failed to join cgroup: %w", err)
+	}
+	return nil
+}
+
+// dropPrivileges clears the ambient capabilities inherited from the daemon
+// and forbids regaining any through setuid or file capabilities. As the
+// sandbox user is not root in its namespace, exec then leaves the program
+// with no capabilities at all.
+func dropPrivileges() error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", errno)
+	}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to set no_new_privs: %w", errno)
+	}
+	return nil
+}
+
+// lookPath resolves name against the PATH in env, as seen from inside the
+// sandbox.
+func lookPath(name string, env []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, "PATH=") {
+			continue
+		}
+		for _, dir := range filepath.SplitList(strings.TrimPrefix(kv, "PATH=")) {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s not found in sandbox PATH", name)
+}
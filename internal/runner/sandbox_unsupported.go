@@ -7,16 +7,27 @@ import (
 	"errors"
 	"log"
 
+	"judge-service/internal/config"
 	"judge-service/internal/store"
 )
 
 // Runner is a stub implementation for non-Linux environments.
-// nsjail requires a Linux kernel, so code execution is not supported.
+// The sandbox relies on Linux namespaces and cgroups, so code execution is not supported.
 type Runner struct{}
 
 // NewRunner returns an error on non-Linux systems.
-func NewRunner() (*Runner, error) {
-	return nil, errors.New("the nsjail runner is only supported on Linux")
+func NewRunner(ctx context.Context, langConfig map[string]config.Language, sandboxConfig config.SandboxConfig) (*Runner, error) {
+	return nil, errors.New("the sandbox runner is only supported on Linux")
+}
+
+// CPUs is a stub.
+func (r *Runner) CPUs() []int {
+	return nil
+}
+
+// Bind is a stub.
+func (r *Runner) Bind(ctx context.Context, cpus []int) *Runner {
+	return r
 }
 
 // PrepareEnvironment is a stub.
@@ -26,19 +37,30 @@ func (r *Runner) PrepareEnvironment(submissionID string, sourceCode string, lang
 }
 
 // Compile is a stub.
-func (r *Runner) Compile(ctx context.Context, submissionID string, lang string, tempDir string) (string, error) {
+func (r *Runner) Compile(tempDir string, lang string) (compileOutput string, err error) {
 	log.Printf("Runner is not supported on this OS. Skipping Compile.")
 	return "", errors.New("unsupported OS")
 }
 
 // Execute is a stub.
-func (r *Runner) Execute(ctx context.Context, submissionID, lang, executablePath string, testCase *store.TestCase, timeLimit int, memoryLimit int) (output string, execTimeMs int, memoryUsedKb int, runtimeErr error) {
+func (r *Runner) Execute(programDir string, lang string, testCase store.TestCase, timeLimitMs int, memoryLimitMb int, outputLimitMb int) store.ExecutionResult {
 	log.Printf("Runner is not supported on this OS. Skipping Execute.")
-	return "", 0, 0, errors.New("unsupported OS")
+	return store.ExecutionResult{Status: store.StatusInternalError, Error: "unsupported OS"}
 }
 
-// CleanupEnvironment is a stub.
-func (r *Runner) CleanupEnvironment(tempDir string) error {
-	log.Printf("Runner is not supported on this OS. Skipping CleanupEnvironment.")
-	return nil
+// Interact is a stub.
+func (r *Runner) Interact(programDir string, lang string, interactorDir string, interactorLang string, testCase store.TestCase, timeLimitMs int, memoryLimitMb int, outputLimitMb int) store.InteractionResult {
+	log.Printf("Runner is not supported on this OS. Skipping Interact.")
+	return store.InteractionResult{Execution: store.ExecutionResult{Status: store.StatusInternalError, Error: "unsupported OS"}}
+}
+
+// Check is a stub.
+func (r *Runner) Check(checkerDir string, lang string, testCase store.TestCase, output string) (exitCode int, message string, err error) {
+	log.Printf("Runner is not supported on this OS. Skipping Check.")
+	return 0, "", errors.New("unsupported OS")
+}
+
+// CleanUp is a stub.
+func (r *Runner) CleanUp(tempDir string) {
+	log.Printf("Runner is not supported on this OS. Skipping CleanUp.")
 }
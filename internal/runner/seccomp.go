@@ -0,0 +1,162 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetTrace       = 0x7ff00000
+	seccompRetAllow       = 0x7fff0000
+
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// baseSyscalls is enough for a statically or dynamically linked C/C++
+// program that only talks to stdin/stdout.
+var baseSyscalls = []string{
+	"read", "write", "readv", "writev", "pread64", "lseek", "close",
+	"fstat", "newfstatat", "statx", "open", "openat", "access", "faccessat", "faccessat2",
+	"readlink", "readlinkat", "ioctl", "fcntl",
+	"brk", "mmap", "munmap", "mremap", "mprotect", "madvise",
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sigaltstack",
+	"arch_prctl", "set_tid_address", "set_robust_list", "rseq", "prlimit64",
+	"getrandom", "futex", "clock_gettime", "clock_getres", "gettimeofday",
+	"nanosleep", "clock_nanosleep", "sched_yield", "restart_syscall",
+	"uname", "sysinfo", "times", "getrusage",
+	"getpid", "gettid", "tgkill", "getuid", "geteuid", "getgid", "getegid",
+	"exit", "exit_group",
+}
+
+// interpreterSyscalls are additionally needed by interpreters such as
+// CPython, which scan directories and duplicate descriptors on startup.
+var interpreterSyscalls = []string{
+	"stat", "lstat", "getdents64", "getcwd", "dup", "dup2", "dup3", "pipe2",
+	"poll", "ppoll", "select", "pselect6", "sched_getaffinity", "getppid",
+	"getresuid", "getresgid", "getgroups", "fstatfs", "mincore", "getcpu",
+}
+
+// jvmSyscalls are additionally needed by the JVM, which runs many threads
+// and keeps bookkeeping files in its temporary directory.
+var jvmSyscalls = []string{
+	"clone", "clone3", "membarrier", "sched_getparam", "sched_getscheduler",
+	"sched_get_priority_min", "sched_get_priority_max", "sched_setaffinity",
+	"getpriority", "prctl", "kill", "tkill", "getrlimit", "setrlimit",
+	"mkdir", "mkdirat", "unlink", "unlinkat", "ftruncate", "fchmod", "fsync",
+	"flock", "statfs", "fadvise64", "msync", "umask", "chdir", "fchdir",
+	"eventfd2", "epoll_create1", "epoll_ctl", "epoll_wait", "epoll_pwait",
+}
+
+// nodeSyscalls are additionally needed by Node.js on top of the JVM set:
+// V8 probes its capabilities and protects JIT code with memory keys.
+var nodeSyscalls = []string{
+	"capget", "pkey_alloc", "pkey_free", "pkey_mprotect",
+}
+
+// seccompProfiles maps the profile names usable in config.Language to the
+// syscalls they allow. Anything else terminates the program.
+var seccompProfiles = map[string][]string{
+	"cpp":    baseSyscalls,
+	"python": concatSyscalls(baseSyscalls, interpreterSyscalls),
+	"jvm":    concatSyscalls(baseSyscalls, interpreterSyscalls, jvmSyscalls),
+	"node":   concatSyscalls(baseSyscalls, interpreterSyscalls, jvmSyscalls, nodeSyscalls),
+}
+
+func concatSyscalls(lists ...[]string) []string {
+	var all []string
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// resolveSeccompProfile returns the syscall numbers allowed by the named
+// profile on this architecture. Syscalls the architecture does not have,
+// such as open on arm64, are skipped. An empty allowlist would run the
+// program unfiltered, so a profile resolving to none is an error.
+func resolveSeccompProfile(name string) ([]int, error) {
+	names, ok := seccompProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown seccomp profile: %q", name)
+	}
+	if auditArch == 0 {
+		return nil, fmt.Errorf("seccomp filtering is not supported on %s", runtime.GOARCH)
+	}
+	seen := make(map[int]bool)
+	var numbers []int
+	for _, n := range names {
+		if nr, ok := syscallNumbers[n]; ok && !seen[nr] {
+			seen[nr] = true
+			numbers = append(numbers, nr)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("seccomp profile %q allows no syscalls on %s", name, runtime.GOARCH)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// describeSyscall formats nr for verdict messages, adding its name when
+// it is one we know.
+func describeSyscall(nr int) string {
+	for name, n := range syscallNumbers {
+		if n == nr {
+			return fmt.Sprintf("%d (%s)", nr, name)
+		}
+	}
+	return fmt.Sprint(nr)
+}
+
+// installSeccomp applies a default-deny filter to the calling thread.
+// Allowed syscalls pass straight through; anything else stops the thread
+// for the tracer with the syscall number as event data. Syscalls made
+// through a foreign ABI kill the process outright with SIGSYS.
+// PR_SET_NO_NEW_PRIVS must already be set.
+func installSeccomp(allowed []int) error {
+	filter := []syscall.SockFilter{
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataArch),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, auditArch, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillProcess),
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataNr),
+	}
+	for _, nr := range allowed {
+		filter = append(filter,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, uint32(nr), 0, 1),
+			bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+		)
+	}
+	filter = append(filter,
+		bpfStmt(syscall.BPF_ALU|syscall.BPF_OR|syscall.BPF_K, seccompRetTrace),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_A, 0),
+	)
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return fmt.Errorf("failed to install seccomp filter: %w", errno)
+	}
+	return nil
+}
+
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -0,0 +1,137 @@
+//go:build linux && amd64
+
+package runner
+
+// auditArch is AUDIT_ARCH_X86_64.
+const auditArch = 0xc000003e
+
+// syscallNumbers holds the x86-64 numbers of the syscalls named by the
+// seccomp profiles, plus a few commonly blocked ones so that violations
+// can be reported by name.
+var syscallNumbers = map[string]int{
+	"read":                   0,
+	"write":                  1,
+	"open":                   2,
+	"close":                  3,
+	"stat":                   4,
+	"fstat":                  5,
+	"lstat":                  6,
+	"poll":                   7,
+	"lseek":                  8,
+	"mmap":                   9,
+	"mprotect":               10,
+	"munmap":                 11,
+	"brk":                    12,
+	"rt_sigaction":           13,
+	"rt_sigprocmask":         14,
+	"rt_sigreturn":           15,
+	"ioctl":                  16,
+	"pread64":                17,
+	"readv":                  19,
+	"writev":                 20,
+	"access":                 21,
+	"pipe":                   22,
+	"select":                 23,
+	"sched_yield":            24,
+	"mremap":                 25,
+	"msync":                  26,
+	"mincore":                27,
+	"madvise":                28,
+	"dup":                    32,
+	"dup2":                   33,
+	"nanosleep":              35,
+	"getpid":                 39,
+	"socket":                 41,
+	"connect":                42,
+	"accept":                 43,
+	"bind":                   49,
+	"listen":                 50,
+	"clone":                  56,
+	"fork":                   57,
+	"vfork":                  58,
+	"execve":                 59,
+	"exit":                   60,
+	"wait4":                  61,
+	"kill":                   62,
+	"uname":                  63,
+	"fcntl":                  72,
+	"flock":                  73,
+	"fsync":                  74,
+	"ftruncate":              77,
+	"getcwd":                 79,
+	"chdir":                  80,
+	"fchdir":                 81,
+	"mkdir":                  83,
+	"unlink":                 87,
+	"readlink":               89,
+	"fchmod":                 91,
+	"umask":                  95,
+	"gettimeofday":           96,
+	"getrlimit":              97,
+	"getrusage":              98,
+	"sysinfo":                99,
+	"times":                  100,
+	"ptrace":                 101,
+	"getuid":                 102,
+	"getgid":                 104,
+	"geteuid":                107,
+	"getegid":                108,
+	"getppid":                110,
+	"getgroups":              115,
+	"getresuid":              118,
+	"getresgid":              120,
+	"capget":                 125,
+	"sigaltstack":            131,
+	"statfs":                 137,
+	"fstatfs":                138,
+	"getpriority":            140,
+	"sched_getparam":         143,
+	"sched_getscheduler":     145,
+	"sched_get_priority_max": 146,
+	"sched_get_priority_min": 147,
+	"prctl":                  157,
+	"arch_prctl":             158,
+	"setrlimit":              160,
+	"mount":                  165,
+	"gettid":                 186,
+	"tkill":                  200,
+	"futex":                  202,
+	"sched_setaffinity":      203,
+	"sched_getaffinity":      204,
+	"getdents64":             217,
+	"set_tid_address":        218,
+	"restart_syscall":        219,
+	"fadvise64":              221,
+	"clock_gettime":          228,
+	"clock_getres":           229,
+	"clock_nanosleep":        230,
+	"exit_group":             231,
+	"epoll_wait":             232,
+	"epoll_ctl":              233,
+	"tgkill":                 234,
+	"openat":                 257,
+	"mkdirat":                258,
+	"newfstatat":             262,
+	"unlinkat":               263,
+	"readlinkat":             267,
+	"faccessat":              269,
+	"pselect6":               270,
+	"ppoll":                  271,
+	"set_robust_list":        273,
+	"epoll_pwait":            281,
+	"eventfd2":               290,
+	"epoll_create1":          291,
+	"dup3":                   292,
+	"pipe2":                  293,
+	"prlimit64":              302,
+	"getcpu":                 309,
+	"getrandom":              318,
+	"membarrier":             324,
+	"pkey_mprotect":          329,
+	"pkey_alloc":             330,
+	"pkey_free":              331,
+	"statx":                  332,
+	"rseq":                   334,
+	"clone3":                 435,
+	"faccessat2":             439,
+}
@@ -0,0 +1,123 @@
+//go:build linux && arm64
+
+package runner
+
+// auditArch is AUDIT_ARCH_AARCH64.
+const auditArch = 0xc00000b7
+
+// syscallNumbers holds the arm64 numbers of the syscalls named by the
+// seccomp profiles, plus a few commonly blocked ones so that violations
+// can be reported by name. Legacy calls such as open and stat do not
+// exist here.
+var syscallNumbers = map[string]int{
+	"getcwd":                 17,
+	"eventfd2":               19,
+	"epoll_create1":          20,
+	"epoll_ctl":              21,
+	"epoll_pwait":            22,
+	"dup":                    23,
+	"dup3":                   24,
+	"fcntl":                  25,
+	"ioctl":                  29,
+	"flock":                  32,
+	"mkdirat":                34,
+	"unlinkat":               35,
+	"mount":                  40,
+	"statfs":                 43,
+	"fstatfs":                44,
+	"ftruncate":              46,
+	"faccessat":              48,
+	"chdir":                  49,
+	"fchdir":                 50,
+	"fchmod":                 52,
+	"openat":                 56,
+	"close":                  57,
+	"pipe2":                  59,
+	"getdents64":             61,
+	"lseek":                  62,
+	"read":                   63,
+	"write":                  64,
+	"readv":                  65,
+	"writev":                 66,
+	"pread64":                67,
+	"pselect6":               72,
+	"ppoll":                  73,
+	"readlinkat":             78,
+	"newfstatat":             79,
+	"fstat":                  80,
+	"fsync":                  82,
+	"capget":                 90,
+	"exit":                   93,
+	"exit_group":             94,
+	"set_tid_address":        96,
+	"futex":                  98,
+	"set_robust_list":        99,
+	"nanosleep":              101,
+	"clock_gettime":          113,
+	"clock_getres":           114,
+	"clock_nanosleep":        115,
+	"ptrace":                 117,
+	"sched_getscheduler":     120,
+	"sched_getparam":         121,
+	"sched_setaffinity":      122,
+	"sched_getaffinity":      123,
+	"sched_yield":            124,
+	"sched_get_priority_max": 125,
+	"sched_get_priority_min": 126,
+	"restart_syscall":        128,
+	"kill":                   129,
+	"tkill":                  130,
+	"tgkill":                 131,
+	"sigaltstack":            132,
+	"rt_sigaction":           134,
+	"rt_sigprocmask":         135,
+	"rt_sigreturn":           139,
+	"getpriority":            141,
+	"getresuid":              148,
+	"getresgid":              150,
+	"times":                  153,
+	"getgroups":              158,
+	"uname":                  160,
+	"getrlimit":              163,
+	"setrlimit":              164,
+	"getrusage":              165,
+	"umask":                  166,
+	"prctl":                  167,
+	"getcpu":                 168,
+	"gettimeofday":           169,
+	"getpid":                 172,
+	"getppid":                173,
+	"getuid":                 174,
+	"geteuid":                175,
+	"getgid":                 176,
+	"getegid":                177,
+	"gettid":                 178,
+	"sysinfo":                179,
+	"socket":                 198,
+	"bind":                   200,
+	"listen":                 201,
+	"accept":                 202,
+	"connect":                203,
+	"brk":                    214,
+	"munmap":                 215,
+	"mremap":                 216,
+	"clone":                  220,
+	"execve":                 221,
+	"mmap":                   222,
+	"fadvise64":              223,
+	"mprotect":               226,
+	"msync":                  227,
+	"mincore":                232,
+	"madvise":                233,
+	"wait4":                  260,
+	"prlimit64":              261,
+	"getrandom":              278,
+	"membarrier":             283,
+	"pkey_mprotect":          288,
+	"pkey_alloc":             289,
+	"pkey_free":              290,
+	"statx":                  291,
+	"rseq":                   293,
+	"clone3":                 435,
+	"faccessat2":             439,
+}
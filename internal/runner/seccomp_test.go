@@ -0,0 +1,19 @@
+//go:build linux
+
+package runner
+
+import "testing"
+
+func TestResolveSeccompProfile(t *testing.T) {
+	for name := range seccompProfiles {
+		allowed, err := resolveSeccompProfile(name)
+		if err != nil {
+			t.Errorf("resolveSeccompProfile(%q): %v", name, err)
+		} else if len(allowed) == 0 {
+			t.Errorf("resolveSeccompProfile(%q) allows no syscalls", name)
+		}
+	}
+	if _, err := resolveSeccompProfile("none"); err == nil {
+		t.Errorf("resolveSeccompProfile of an unknown profile succeeded")
+	}
+}
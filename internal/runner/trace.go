@@ -0,0 +1,107 @@
+//go:build linux
+
+package runner
+
+import (
+	"syscall"
+)
+
+const (
+	ptraceEventSeccomp  = 7
+	ptraceOTraceSeccomp = 0x80
+	ptraceOExitKill     = 0x100000
+)
+
+// programExit describes how the supervised program ended.
+type programExit struct {
+	Status syscall.WaitStatus
+	Rusage syscall.Rusage
+
+	// Restricted is set when the program was killed for making a syscall
+	// outside its seccomp profile, recorded in Syscall.
+	Restricted bool
+	Syscall    int
+}
+
+// waitProgram waits for the untraced program pid to exit.
+func waitProgram(pid int) (exit programExit, err error) {
+	for {
+		_, err = syscall.Wait4(pid, &exit.Status, 0, &exit.Rusage)
+		if err != syscall.EINTR {
+			return exit, err
+		}
+	}
+}
+
+// traceProgram runs the ptrace loop for pid, which must have been started
+// with PTRACE_TRACEME by the calling OS thread. It follows every thread and
+// child of the program. The first syscall that stops for the tracer after
+// the program was exec'd kills the whole sandbox; before that, stops come
+// from the exec stage itself and are let through.
+func traceProgram(pid int) (exit programExit, err error) {
+	attached := map[int]bool{pid: true}
+	optionsSet := false
+	started := false
+
+	for {
+		var status syscall.WaitStatus
+		var rusage syscall.Rusage
+		wpid, err := syscall.Wait4(-1, &status, syscall.WALL, &rusage)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return exit, err
+		}
+
+		if status.Exited() || status.Signaled() {
+			delete(attached, wpid)
+			if wpid == pid {
+				exit.Status = status
+				exit.Rusage = rusage
+				return exit, nil
+			}
+			continue
+		}
+		if !status.Stopped() {
+			continue
+		}
+
+		sig := status.StopSignal()
+		switch status.TrapCause() {
+		case ptraceEventSeccomp:
+			if started {
+				nr, _ := syscall.PtraceGetEventMsg(wpid)
+				exit.Restricted = true
+				exit.Syscall = int(nr)
+				// From PID 1 this reaches everything in the namespace
+				// except ourselves.
+				syscall.Kill(-1, syscall.SIGKILL)
+				continue
+			}
+			sig = 0
+		case syscall.PTRACE_EVENT_EXEC:
+			started = true
+			sig = 0
+		case syscall.PTRACE_EVENT_FORK, syscall.PTRACE_EVENT_VFORK, syscall.PTRACE_EVENT_CLONE:
+			sig = 0
+		case 0:
+			// The first of these follows PTRACE_TRACEME's exec of the
+			// stage; later ones are genuine SIGTRAPs.
+			if !optionsSet {
+				syscall.PtraceSetOptions(pid, ptraceOTraceSeccomp|ptraceOExitKill|syscall.PTRACE_O_TRACEEXEC|
+					syscall.PTRACE_O_TRACEFORK|syscall.PTRACE_O_TRACEVFORK|syscall.PTRACE_O_TRACECLONE)
+				optionsSet = true
+				sig = 0
+			}
+		default:
+			// New threads and children start with a SIGSTOP that must
+			// not be delivered.
+			if !attached[wpid] && sig == syscall.SIGSTOP {
+				attached[wpid] = true
+				sig = 0
+			}
+		}
+		syscall.PtraceCont(wpid, int(sig))
+	}
+}
@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,16 +16,37 @@ import (
 
 // --- Status Constants ---
 const (
-	StatusPending             = "Pending"
-	StatusJudging             = "Judging"
-	StatusAccepted            = "Accepted"
-	StatusWrongAnswer         = "Wrong Answer"
-	StatusTimeLimitExceeded   = "Time Limit Exceeded"
-	StatusMemoryLimitExceeded = "Memory Limit Exceeded"
-	StatusCompilationError    = "Compilation Error"
-	StatusRuntimeError        = "Runtime Error"
-	StatusInternalError       = "Internal Error"
-	StatusCompleted           = "Completed"
+	StatusPending               = "Pending"
+	StatusJudging               = "Judging"
+	StatusAccepted              = "Accepted"
+	StatusWrongAnswer           = "Wrong Answer"
+	StatusPresentationError     = "Presentation Error"
+	StatusPartial               = "Partial"
+	StatusTimeLimitExceeded     = "Time Limit Exceeded"
+	StatusIdlenessLimitExceeded = "Idleness Limit Exceeded"
+	StatusMemoryLimitExceeded   = "Memory Limit Exceeded"
+	StatusOutputLimitExceeded   = "Output Limit Exceeded"
+	StatusProcessLimitExceeded  = "Process Limit Exceeded"
+	StatusCompilationError      = "Compilation Error"
+	StatusRuntimeError          = "Runtime Error"
+	StatusRestrictedFunction    = "Restricted Function"
+	StatusInternalError         = "Internal Error"
+	StatusCheckerFailure        = "Checker Failure"
+	StatusCompleted             = "Completed"
+	StatusSkipped               = "Skipped" // Test not run because it could not change the score
+)
+
+// --- Problem Types ---
+const (
+	ProblemTypeStandard    = "standard"    // Output is judged after the program ends; the default
+	ProblemTypeInteractive = "interactive" // The program talks to the problem's interactor
+)
+
+// --- Subtask Scoring Policies ---
+const (
+	ScoringAllOrNothing = "all" // Full points if every test is accepted, else none; the default
+	ScoringMin          = "min" // Points scaled by the lowest test score
+	ScoringSum          = "sum" // Points shared equally among the tests, each scaled by its score
 )
 
 // --- Data Structures ---
@@ -38,21 +62,81 @@ type Problem struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty"`
 	Title       string             `bson:"title"`
 	Description string             `bson:"description"`
-	TimeLimit   int                `bson:"timeLimit"`   // In seconds, as per your schema
-	MemoryLimit int                `bson:"memoryLimit"` // In megabytes
+	TimeLimit   int                `bson:"timeLimit"`             // In seconds, as per your schema
+	MemoryLimit int                `bson:"memoryLimit"`           // In megabytes
+	OutputLimit int                `bson:"outputLimit,omitempty"` // In megabytes, 0 for the judge's default
 	TestCases   []TestCase         `bson:"testCases"`
+	Type        string             `bson:"type,omitempty"` // One of the ProblemType constants, empty for standard
+
+	// SpecialJudge is a checker deciding whether an output is correct,
+	// for problems that accept more than one answer. Without one, outputs
+	// are compared with the expected output as Checker selects.
+	SpecialJudge *ProgramRef `bson:"specialJudge,omitempty"`
+	Checker      CheckerSpec `bson:"checker,omitempty"`
+
+	// Interactor is the program an interactive problem's submissions talk
+	// to. It reads the test input and decides the verdict.
+	Interactor *ProgramRef `bson:"interactor,omitempty"`
+
+	// Subtasks make the problem scored: each subtask's points are earned
+	// according to its tests, and the submission's score is their sum.
+	// Without subtasks, judging stops at the first failed test.
+	Subtasks []Subtask `bson:"subtasks,omitempty"`
+
+	// RunAllTests judges every test even after one fails, for practice
+	// problems where the number of passed tests matters.
+	RunAllTests bool `bson:"runAllTests,omitempty"`
+}
+
+// Subtask is a group of test cases scored together.
+type Subtask struct {
+	Name    string  `bson:"name,omitempty"`
+	Points  float64 `bson:"points"`
+	Tests   []int   `bson:"tests"`             // 1-based test case numbers; a test may be in several subtasks
+	Scoring string  `bson:"scoring,omitempty"` // One of the Scoring constants, empty for all-or-nothing
+
+	// DependsOn lists earlier subtasks, by 1-based number, that must earn
+	// full points for this one to earn any.
+	DependsOn []int `bson:"dependsOn,omitempty"`
+}
+
+// IsInteractive reports whether submissions are judged by the interactor.
+func (p *Problem) IsInteractive() bool {
+	return p.Type == ProblemTypeInteractive
+}
+
+// CheckerSpec selects one of the built-in ways of comparing an output with
+// the expected output. The zero value compares lines, ignoring trailing
+// whitespace.
+type CheckerSpec struct {
+	Mode       string  `bson:"mode,omitempty"`       // e.g. "tokens" or "float"; see core.NewComparator
+	AbsEpsilon float64 `bson:"absEpsilon,omitempty"` // Absolute tolerance of the "float" mode
+	RelEpsilon float64 `bson:"relEpsilon,omitempty"` // Relative tolerance of the "float" mode
+
+	// StrictLayout turns a wrong output whose tokens all match the expected
+	// ones, i.e. one that differs only in whitespace and line breaks, into
+	// a Presentation Error instead of a Wrong Answer.
+	StrictLayout bool `bson:"strictLayout,omitempty"`
+}
+
+// ProgramRef is the source of a helper program that comes with a problem,
+// such as a checker. It is compiled like a submission.
+type ProgramRef struct {
+	Language string `bson:"language"`
+	Source   string `bson:"source"`
 }
 
 // Submission matches the 'submissions' collection schema provided by you.
 type Submission struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	UserID    primitive.ObjectID `bson:"userId"`
-	ProblemID primitive.ObjectID `bson:"problemId"`
-	Code      string             `bson:"code"` // MATCHES YOUR SCHEMA
-	Language  string             `bson:"language"`
-	Status    string             `bson:"status"`
-	CreatedAt time.Time          `bson:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `bson:"userId"`
+	ProblemID   primitive.ObjectID `bson:"problemId"`
+	Code        string             `bson:"code"` // MATCHES YOUR SCHEMA
+	Language    string             `bson:"language"`
+	Status      string             `bson:"status"`
+	RunAllTests bool               `bson:"runAllTests,omitempty"` // As Problem.RunAllTests, for this submission only
+	CreatedAt   time.Time          `bson:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt"`
 }
 
 // --- Payloads and Results ---
@@ -60,25 +144,98 @@ type Submission struct {
 // SubmissionPayload is the message sent to the queue.
 type SubmissionPayload struct {
 	SubmissionID string `json:"submissionId"`
+	// Priority optionally names the list queue the job belongs in. A job
+	// taken from another queue is moved there rather than judged at once.
+	// BullMQ jobs have priorities of their own instead.
+	Priority string `json:"priority,omitempty"`
 }
 
 // ExecutionResult is the raw result from running the code against one test case.
 type ExecutionResult struct {
-	Status          string
-	Error           string
-	Output          string
-	ExecutionTimeMs int
-	MemoryUsedKb    uint64
+	Status       string
+	Error        string
+	Output       string
+	CpuTimeMs    int
+	WallTimeMs   int
+	MemoryUsedKb uint64
+	ExitCode     int // -1 when the program was killed by a signal
+	Signal       int // Terminating signal, 0 if the program exited normally
+}
+
+// InteractionResult is the raw result from running the code against the
+// interactor on one test case.
+type InteractionResult struct {
+	Execution ExecutionResult // The submission's run; its Output is not captured
+
+	InteractorExitCode int
+	InteractorMessage  string // What the interactor printed to stderr
+	InteractorError    string // Why the interactor gave no verdict, if it did not
+}
+
+// signalReasons explains the signals a crashing submission usually dies from.
+var signalReasons = map[syscall.Signal]string{
+	syscall.SIGSEGV: "segmentation fault",
+	syscall.SIGFPE:  "division by zero",
+	syscall.SIGABRT: "abort/assert",
+	syscall.SIGBUS:  "bus error",
+	syscall.SIGILL:  "illegal instruction",
+	syscall.SIGKILL: "killed",
+}
+
+// ExitReason describes how the program ended, for runtime error verdicts.
+func (r ExecutionResult) ExitReason() string {
+	if r.Signal != 0 {
+		sig := syscall.Signal(r.Signal)
+		reason, ok := signalReasons[sig]
+		if !ok {
+			reason = sig.String()
+		}
+		if number := fmt.Sprintf("signal %d", r.Signal); reason != number {
+			return fmt.Sprintf("%s (%s)", reason, number)
+		}
+		return reason // A signal without a name
+	}
+	if r.ExitCode != 0 {
+		return fmt.Sprintf("non-zero exit code %d", r.ExitCode)
+	}
+	return ""
 }
 
 // SubmissionResult is used to update the database with the final outcome.
 // The BSON tags here match the fields in your original schema.
 type SubmissionResult struct {
-	Status        string    `bson:"status"`
-	ExecutionTime int       `bson:"executionTime,omitempty"`
-	MemoryUsed    uint64    `bson:"memoryUsed,omitempty"`
-	CompileOutput string    `bson:"compileOutput,omitempty"`
-	UpdatedAt     time.Time `bson:"updatedAt"`
+	Status         string          `bson:"status"`
+	ExecutionTime  int             `bson:"executionTime,omitempty"`
+	MemoryUsed     uint64          `bson:"memoryUsed,omitempty"`
+	CompileOutput  string          `bson:"compileOutput,omitempty"`
+	Reason         string          `bson:"reason,omitempty"`         // Human-readable cause of a runtime error
+	CheckerMessage string          `bson:"checkerMessage,omitempty"` // What the checker or interactor said about the output
+	TestResults    []TestResult    `bson:"testResults,omitempty"`    // The tests run, in order
+	PassedTests    int             `bson:"passedTests,omitempty"`    // Tests accepted
+	TotalTests     int             `bson:"totalTests,omitempty"`     // Test cases of the problem, run or not
+	Score          float64         `bson:"score,omitempty"`          // Points earned on a problem with subtasks
+	MaxScore       float64         `bson:"maxScore,omitempty"`       // Points available on a problem with subtasks
+	Subtasks       []SubtaskResult `bson:"subtasks,omitempty"`
+	UpdatedAt      time.Time       `bson:"updatedAt"`
+}
+
+// TestResult is the outcome of one test case of a submission.
+type TestResult struct {
+	Index          int     `bson:"index"` // 1-based position in the problem's test cases
+	Status         string  `bson:"status"`
+	ExecutionTime  int     `bson:"executionTime"` // CPU time in milliseconds
+	MemoryUsed     uint64  `bson:"memoryUsed"`    // Peak memory in kilobytes
+	ExitCode       int     `bson:"exitCode"`
+	Score          float64 `bson:"score"` // Fraction of the test's points earned, between 0 and 1
+	CheckerMessage string  `bson:"checkerMessage,omitempty"`
+}
+
+// SubtaskResult is the score of one subtask of a submission.
+type SubtaskResult struct {
+	Index    int     `bson:"index"` // 1-based position in the problem's subtasks
+	Name     string  `bson:"name,omitempty"`
+	Score    float64 `bson:"score"`
+	MaxScore float64 `bson:"maxScore"`
 }
 
 // MongoStore holds the database connection.
@@ -148,16 +305,38 @@ func (s *MongoStore) UpdateSubmissionStatus(ctx context.Context, id, status stri
 }
 
 // UpdateSubmissionResult updates the submission with the final result.
+// Result fields the result leaves empty are removed, so that nothing of an
+// earlier judging of the submission is left behind.
 func (s *MongoStore) UpdateSubmissionResult(ctx context.Context, id string, result SubmissionResult) error {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("invalid submission ID format: %w", err)
 	}
 	result.UpdatedAt = time.Now()
+	update := bson.M{"$set": result}
+	if unset := emptyResultFields(result); len(unset) > 0 {
+		update["$unset"] = unset
+	}
 	_, err = s.db.Collection("submissions").UpdateOne(
 		ctx,
 		bson.M{"_id": objID},
-		bson.M{"$set": result},
+		update,
 	)
 	return err
 }
+
+// emptyResultFields returns the fields of SubmissionResult that result
+// leaves out of the document as empty, in the form of an $unset.
+func emptyResultFields(result SubmissionResult) bson.M {
+	unset := bson.M{}
+	value := reflect.ValueOf(result)
+	for i := 0; i < value.NumField(); i++ {
+		name, opts, _ := strings.Cut(value.Type().Field(i).Tag.Get("bson"), ",")
+		field := value.Field(i)
+		empty := field.IsZero() || field.Kind() == reflect.Slice && field.Len() == 0
+		if opts == "omitempty" && empty {
+			unset[name] = ""
+		}
+	}
+	return unset
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEmptyResultFields(t *testing.T) {
+	result := SubmissionResult{
+		Status:        StatusWrongAnswer,
+		ExecutionTime: 120,
+		Reason:        "",
+		TestResults:   []TestResult{{Index: 1, Status: StatusWrongAnswer}},
+		Subtasks:      []SubtaskResult{},
+		PassedTests:   0,
+		TotalTests:    3,
+	}
+	var got []string
+	for name := range emptyResultFields(result) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"checkerMessage", "compileOutput", "maxScore", "memoryUsed", "passedTests", "reason", "score", "subtasks"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("emptyResultFields unsets %v, want %v", got, want)
+	}
+
+	// Every field is either set or unset.
+	data, err := bson.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set bson.M
+	if err := bson.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range got {
+		if _, ok := set[name]; ok {
+			t.Errorf("%s both set and unset", name)
+		}
+	}
+	if fields := reflect.TypeOf(result).NumField(); len(set)+len(got) != fields {
+		t.Errorf("%d fields set and %d unset, want %d in all", len(set), len(got), fields)
+	}
+}
+
+func TestEmptyResultFieldsFull(t *testing.T) {
+	result := SubmissionResult{
+		Status:         StatusPartial,
+		ExecutionTime:  1,
+		MemoryUsed:     1,
+		CompileOutput:  "warning",
+		Reason:         "reason",
+		CheckerMessage: "message",
+		TestResults:    []TestResult{{}},
+		PassedTests:    1,
+		TotalTests:     2,
+		Score:          0.5,
+		MaxScore:       1,
+		Subtasks:       []SubtaskResult{{}},
+	}
+	if unset := emptyResultFields(result); len(unset) != 0 {
+		t.Errorf("emptyResultFields of a full result unsets %v", unset)
+	}
+}
+
+func TestExitReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ExecutionResult
+		want   string
+	}{
+		{"exited normally", ExecutionResult{}, ""},
+		{"non-zero exit code", ExecutionResult{ExitCode: 3}, "non-zero exit code 3"},
+		{"negative exit code", ExecutionResult{ExitCode: -2}, "non-zero exit code -2"},
+		{"segmentation fault", ExecutionResult{ExitCode: -1, Signal: 11}, "segmentation fault (signal 11)"},
+		{"abort", ExecutionResult{ExitCode: -1, Signal: 6}, "abort/assert (signal 6)"},
+		{"signal without a reason", ExecutionResult{ExitCode: -1, Signal: 15}, "terminated (signal 15)"},
+		{"unknown signal", ExecutionResult{ExitCode: -1, Signal: 99}, "signal 99"},
+		{"signal over exit code", ExecutionResult{ExitCode: 1, Signal: 9}, "killed (signal 9)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.ExitReason(); got != tt.want {
+				t.Errorf("ExitReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+const { Queue, QueueEvents } = require('bullmq');
+
+// The judge daemon consumes this queue directly when run with
+// QUEUE_MODE=bullmq and REDIS_QUEUE_NAME set to the same name.
+const QUEUE_NAME = 'submission_queue';
+const connection = {
+  host: 'localhost',
+  port: 6379,
+};
+
+async function addSubmissionJob(submissionId) {
+  if (!submissionId) {
+    console.error('Error: submissionId is required to add a job.');
+    process.exit(1);
+  }
+
+  const queue = new Queue(QUEUE_NAME, { connection });
+  const queueEvents = new QueueEvents(QUEUE_NAME, { connection });
+
+  const job = await queue.add('judge', { submissionId }, {
+    attempts: 3,
+    backoff: { type: 'exponential', delay: 1000 },
+    removeOnComplete: 1000,
+    removeOnFail: 5000,
+  });
+  console.log(`Added job ${job.id} for submission ${submissionId} to '${QUEUE_NAME}'`);
+
+  // The return value is the judged result of the submission.
+  const result = await job.waitUntilFinished(queueEvents);
+  console.log(`Job ${job.id} completed with status ${result.Status}`);
+
+  await queueEvents.close();
+  await queue.close();
+}
+
+const submissionId = process.argv[2];
+
+addSubmissionJob(submissionId).catch(err => {
+  console.error('Error judging submission:', err);
+  process.exit(1);
+});